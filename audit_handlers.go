@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 監査ログの操作
+const (
+	auditCreate   = "create"
+	auditUpdate   = "update"
+	auditDelete   = "delete"
+	auditRestore  = "restore"
+	auditPurge    = "purge"
+	auditRollback = "rollback"
+	auditImport   = "import"
+)
+
+// 監査ログの対象
+const (
+	auditEntityMovie      = "movie"
+	auditEntityPerson     = "person"
+	auditEntityCollection = "collection"
+	auditEntityTag        = "tag"
+	auditEntityProvider   = "provider"
+	auditEntityGenre      = "genre"
+	auditEntityWebhook    = "webhook"
+)
+
+// audit 管理操作を監査ログに記録する
+// 操作と同じトランザクションのdbに書き込み、記録に失敗した場合は操作ごとロールバックできるようエラーを返す
+func (app *application) audit(ctx context.Context, db *models.DBModel, action, entity string, entityID int, before, after interface{}) error {
+	e, err := models.NewAuditEntry(userIDFromContext(ctx), action, entity, entityID, before, after)
+	if err != nil {
+		return err
+	}
+	e.RequestID = requestIDFromContext(ctx)
+
+	return db.InsertAuditEntry(e)
+}
+
+// getAuditLog 監査ログを検索する
+// クエリパラメータ: actor, action, entity, entity_id, since, until (RFC 3339), limit
+func (app *application) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var f models.AuditFilter
+	var err error
+	f.Action = q.Get("action")
+	f.Entity = q.Get("entity")
+
+	for name, dest := range map[string]*int{"actor": &f.ActorUserID, "entity_id": &f.EntityID, "limit": &f.Limit} {
+		if v := q.Get(name); v != "" {
+			if *dest, err = strconv.Atoi(v); err != nil {
+				app.errorJSON(w, err)
+				return
+			}
+		}
+	}
+
+	for name, dest := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			if *dest, err = time.Parse(time.RFC3339, v); err != nil {
+				app.errorJSON(w, err)
+				return
+			}
+		}
+	}
+
+	entries, err := app.models.DB.GetAuditEntries(f)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, entries, "audit_log")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
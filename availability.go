@@ -0,0 +1,413 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// currencyPattern ISO 4217の通貨コード
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// validOfferTypes 配信の提供形態
+var validOfferTypes = map[string]bool{models.OfferSubscription: true, models.OfferRent: true, models.OfferBuy: true}
+
+// ProviderPayload 配信サービスの作成・更新のリクエストボディ
+type ProviderPayload struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// AvailabilityPayload 映画の配信1件
+// providerは配信サービスのスラッグ。priceはrent・buyの場合に必須で、currencyと合わせて指定する
+// valid_from・valid_toはRFC 3339形式で、省略した場合は期限なし
+type AvailabilityPayload struct {
+	Provider  string   `json:"provider"`
+	Region    string   `json:"region"`
+	Type      string   `json:"type"`
+	Price     *float64 `json:"price"`
+	Currency  string   `json:"currency"`
+	URL       string   `json:"url"`
+	ValidFrom string   `json:"valid_from"`
+	ValidTo   string   `json:"valid_to"`
+}
+
+// AvailabilityListPayload 映画の配信を置き換えるリクエストボディ
+type AvailabilityListPayload struct {
+	Version      int                   `json:"version"`
+	Availability []AvailabilityPayload `json:"availability"`
+}
+
+// validWebURL httpまたはhttpsの絶対URLであるか
+func validWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateAvailability 配信1件を検証し、models.Availabilityにする
+// providersはスラッグをキーにした配信サービス
+func validateAvailability(p AvailabilityPayload, providers map[string]*models.Provider) (models.Availability, error) {
+	a := models.Availability{
+		Region:   normalizeCountry(p.Region),
+		Type:     p.Type,
+		Price:    p.Price,
+		Currency: strings.ToUpper(strings.TrimSpace(p.Currency)),
+		URL:      strings.TrimSpace(p.URL),
+	}
+
+	provider, ok := providers[strings.ToLower(strings.TrimSpace(p.Provider))]
+	if !ok {
+		return a, fmt.Errorf("provider %q not found", p.Provider)
+	}
+	a.ProviderID, a.ProviderSlug, a.ProviderName = provider.ID, provider.Slug, provider.Name
+
+	if a.Region == "" {
+		return a, errors.New("region must be an ISO 3166-1 alpha-2 code such as JP or US")
+	}
+	if !validOfferTypes[a.Type] {
+		return a, errors.New("type must be subscription, rent or buy")
+	}
+	if a.Price == nil && a.Type != models.OfferSubscription {
+		return a, fmt.Errorf("price is required for %s", a.Type)
+	}
+	if a.Price != nil && *a.Price < 0 {
+		return a, errors.New("price must not be negative")
+	}
+	if a.Price != nil && !currencyPattern.MatchString(a.Currency) {
+		return a, errors.New("currency must be an ISO 4217 code such as JPY or USD")
+	}
+	if a.Price == nil && a.Currency != "" {
+		return a, errors.New("currency must be omitted without price")
+	}
+	if !validWebURL(a.URL) {
+		return a, errors.New("url must be an http or https URL")
+	}
+
+	for _, v := range []struct {
+		name  string
+		value string
+		dest  **time.Time
+	}{{"valid_from", p.ValidFrom, &a.ValidFrom}, {"valid_to", p.ValidTo, &a.ValidTo}} {
+		if v.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v.value)
+		if err != nil {
+			return a, fmt.Errorf("%s must be a time in RFC 3339 format", v.name)
+		}
+		*v.dest = &t
+	}
+	if a.ValidFrom != nil && a.ValidTo != nil && !a.ValidFrom.Before(*a.ValidTo) {
+		return a, errors.New("valid_to must be after valid_from")
+	}
+
+	return a, nil
+}
+
+// availableNow 配信を現在視聴できるもの（regionがある場合はその国のもの）に絞り込んだ複製を返す
+// 絞り込む必要が無い場合はmovieをそのまま返す
+func availableNow(movie *models.Movie, region string, now time.Time) *models.Movie {
+	available := make([]*models.Availability, 0, len(movie.Availability))
+	for _, a := range movie.Availability {
+		if a.Current(now) && (region == "" || a.Region == region) {
+			available = append(available, a)
+		}
+	}
+	if len(available) == len(movie.Availability) {
+		return movie
+	}
+
+	m := *movie
+	m.Availability = available
+	return &m
+}
+
+// availabilityChangedAt 配信の提供期間の開始・終了のうち、nowまでに過ぎた最も新しい時点を返す
+// 期限付きの配信は保存し直さなくても表示が変わるため、ETagと最終更新日時に含める
+func availabilityChangedAt(movie *models.Movie, now time.Time) time.Time {
+	var changed time.Time
+	for _, a := range movie.Availability {
+		for _, t := range []*time.Time{a.ValidFrom, a.ValidTo} {
+			if t != nil && !t.After(now) && t.After(changed) {
+				changed = *t
+			}
+		}
+	}
+	return changed
+}
+
+// providersFromQuery クエリパラメータprovider（複数指定可）のスラッグを返す
+func providersFromQuery(q url.Values) []string {
+	var providers []string
+	for _, slug := range q["provider"] {
+		if slug = strings.ToLower(strings.TrimSpace(slug)); slug != "" {
+			providers = append(providers, slug)
+		}
+	}
+	return providers
+}
+
+// filterMoviesByProviders providersのいずれかで視聴できる映画に絞り込む。providersが空の場合はmoviesをそのまま返す
+// moviesは提供期間外の配信を除いたもの（regionalizeMovies適用後）を渡す
+func filterMoviesByProviders(movies []*models.Movie, providers []string) []*models.Movie {
+	if len(providers) == 0 {
+		return movies
+	}
+
+	filtered := []*models.Movie{}
+	for _, movie := range movies {
+	availability:
+		for _, a := range movie.Availability {
+			for _, slug := range providers {
+				if a.ProviderSlug == slug {
+					filtered = append(filtered, movie)
+					break availability
+				}
+			}
+		}
+	}
+	return filtered
+}
+
+// getProviders 配信サービスの一覧を返す
+func (app *application) getProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := app.models.DB.GetProviders()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, providers, "providers")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editProvider IDが0の場合は配信サービスを作成し、それ以外の場合は更新する
+func (app *application) editProvider(w http.ResponseWriter, r *http.Request) {
+	var payload ProviderPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	provider := models.Provider{
+		ID:        payload.ID,
+		Slug:      strings.ToLower(strings.TrimSpace(payload.Slug)),
+		Name:      strings.TrimSpace(payload.Name),
+		URL:       strings.TrimSpace(payload.URL),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if provider.Name == "" {
+		app.errorJSON(w, errors.New("name is required"))
+		return
+	}
+	if !slugPattern.MatchString(provider.Slug) {
+		app.errorJSON(w, errors.New("slug must consist of lowercase letters, digits and single hyphens"))
+		return
+	}
+	if provider.URL != "" && !validWebURL(provider.URL) {
+		app.errorJSON(w, errors.New("url must be an http or https URL"))
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var before *models.Provider
+		var err error
+		action := auditUpdate
+		if provider.ID == 0 {
+			action = auditCreate
+			provider.ID, err = db.InsertProvider(provider)
+		} else {
+			before, err = db.GetProvider(provider.ID)
+			if err == nil {
+				err = db.UpdateProvider(provider)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, action, auditEntityProvider, provider.ID, before, provider)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("provider not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrDuplicateProvider {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteProvider 配信サービスと、それを使った映画の配信を削除する
+func (app *application) deleteProvider(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetProvider(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteProvider(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditDelete, auditEntityProvider, id, before, nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("provider not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getMovieAvailability 映画の配信を提供期間外のものも含めて返す
+func (app *application) getMovieAvailability(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	movie, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, movie.Availability, "availability")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editMovieAvailability 映画の配信を置き換える
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieAvailability(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload AvailabilityListPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	list, err := app.models.DB.GetProviders()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	providers := make(map[string]*models.Provider, len(list))
+	for _, p := range list {
+		providers[p.Slug] = p
+	}
+
+	availability := make([]models.Availability, 0, len(payload.Availability))
+	seen := make(map[string]bool)
+	for i, p := range payload.Availability {
+		a, err := validateAvailability(p, providers)
+		if err != nil {
+			app.errorJSON(w, fmt.Errorf("availability[%d]: %v", i, err))
+			return
+		}
+		key := a.ProviderSlug + ":" + a.Region + ":" + a.Type
+		if seen[key] {
+			app.errorJSON(w, fmt.Errorf("availability[%d]: %s on %s in %s is listed more than once", i, a.Type, a.ProviderSlug, a.Region))
+			return
+		}
+		seen[key] = true
+		availability = append(availability, a)
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SetMovieAvailability(id, expectedVersion, availability)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
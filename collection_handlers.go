@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slugPattern 特集のスラッグ（URLに使う小文字英数字とハイフン）
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CollectionPayload 特集の作成・更新のリクエストボディ
+type CollectionPayload struct {
+	ID          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// CollectionMoviesPayload 特集の映画を置き換えるリクエストボディ（並び順のとおりに指定する）
+type CollectionMoviesPayload struct {
+	MovieIDs []int `json:"movie_ids"`
+}
+
+// getCollections 特集の一覧を返す（映画は含めない）
+func (app *application) getCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.models.DB.GetCollections()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, collections, "collections")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getCollection スラッグに一致する特集を、映画を特集内の順に並べて返す
+func (app *application) getCollection(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	region, err := regionFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	collection, err := app.models.DB.GetCollection(params.ByName("slug"))
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Authorization")
+	w.Header().Add("Vary", "Accept-Language")
+	collection.Movies, err = app.withWatchlistFlags(r, localizeMovies(regionalizeMovies(collection.Movies, region), preferredLocales(r)))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, collection, "collection")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editCollection IDが0の場合は特集を作成し、それ以外の場合は更新する
+func (app *application) editCollection(w http.ResponseWriter, r *http.Request) {
+	var payload CollectionPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	collection := models.Collection{
+		ID:          payload.ID,
+		Slug:        strings.ToLower(strings.TrimSpace(payload.Slug)),
+		Title:       strings.TrimSpace(payload.Title),
+		Description: payload.Description,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if collection.Title == "" {
+		app.errorJSON(w, errors.New("title is required"))
+		return
+	}
+	if !slugPattern.MatchString(collection.Slug) {
+		app.errorJSON(w, errors.New("slug must consist of lowercase letters, digits and single hyphens"))
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var before *models.Collection
+		var err error
+		action := auditUpdate
+		if collection.ID == 0 {
+			action = auditCreate
+			collection.ID, err = db.InsertCollection(collection)
+		} else {
+			before, err = db.GetCollectionByID(collection.ID)
+			if err == nil {
+				err = db.UpdateCollection(collection)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		after := collectionAuditState(&collection)
+		if before != nil {
+			after.Movies = collectionAuditState(before).Movies
+		}
+		return app.audit(r.Context(), db, action, auditEntityCollection, collection.ID, collectionAuditState(before), after)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrDuplicateSlug {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteCollection 特集を削除する（映画は削除しない）
+func (app *application) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetCollectionByID(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteCollection(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditDelete, auditEntityCollection, id, collectionAuditState(before), nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editCollectionMovies 特集の映画をmovie_idsの順に置き換える
+// 映画の追加・削除・並び替えはすべてこのエンドポイントで行う
+func (app *application) editCollectionMovies(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload CollectionMoviesPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	seen := make(map[int]bool)
+	for i, movieID := range payload.MovieIDs {
+		if seen[movieID] {
+			app.errorJSON(w, fmt.Errorf("movie_ids[%d]: movie %d is listed more than once", i, movieID), http.StatusUnprocessableEntity)
+			return
+		}
+		seen[movieID] = true
+		if _, err := app.models.DB.GetMovie(movieID); err != nil {
+			app.errorJSON(w, fmt.Errorf("movie_ids[%d]: movie %d not found", i, movieID), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetCollectionByID(id)
+		if err != nil {
+			return err
+		}
+		if err := db.SetCollectionMovies(id, payload.MovieIDs); err != nil {
+			return err
+		}
+
+		after := *collectionAuditState(before)
+		after.Movies = append([]int{}, payload.MovieIDs...)
+		return app.audit(r.Context(), db, auditUpdate, auditEntityCollection, id, collectionAuditState(before), after)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("collection not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// collectionAudit 監査ログに記録する特集の状態（映画はIDだけを記録する）
+type collectionAudit struct {
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Movies      []int  `json:"movies"`
+}
+
+// collectionAuditState 特集を監査ログに記録する形にする。cがnilの場合はnilを返す
+func collectionAuditState(c *models.Collection) *collectionAudit {
+	if c == nil {
+		return nil
+	}
+	a := &collectionAudit{Slug: c.Slug, Title: c.Title, Description: c.Description, Movies: []int{}}
+	for _, m := range c.Movies {
+		a.Movies = append(a.Movies, m.ID)
+	}
+	return a
+}
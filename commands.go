@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// commands サーバーを起動せずに実行するサブコマンド
+var commands = map[string]func(args []string) int{
+	"import": runImportCommand,
+	"export": runExportCommand,
+}
+
+// commandApp サブコマンド用にDBへ接続したapplicationを作成する
+func commandApp(dsn string) (*application, func(), error) {
+	var cfg config
+	cfg.db.dsn = dsn
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	app := &application{
+		config: cfg,
+		logger: log.New(os.Stderr, "", log.Ldate|log.Ltime),
+		models: models.NewModels(db, nil),
+		events: newEventBus(),
+	}
+
+	return app, func() { db.Close() }, nil
+}
+
+// runImportCommand ファイル（"-"の場合は標準入力）から映画を一括で取り込み、結果をJSONで出力する
+// usage: manage-movies-api import [-dsn DSN] [-format csv|json|ndjson] [-dry-run] [-atomic] FILE
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dsn := fs.String("dsn", defaultDSN, "Postgres connection starting")
+	format := fs.String("format", "", "Input format (csv|json|ndjson); inferred from the file extension if omitted")
+	dryRun := fs.Bool("dry-run", false, "Validate and report without writing")
+	atomic := fs.Bool("atomic", false, "Write nothing if any row fails")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import [flags] FILE")
+		fs.PrintDefaults()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	f, err := importFormat(*format, "", path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	records, err := parseImport(in, f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	app, closeDB, err := commandApp(*dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeDB()
+
+	summary, err := app.importMovies(context.Background(), records, models.ImportOptions{DryRun: *dryRun, Atomic: *atomic})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	js, _ := json.MarshalIndent(summary, "", "\t")
+	fmt.Println(string(js))
+
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runExportCommand 映画をファイル（省略時は標準出力）に書き出す
+// usage: manage-movies-api export [-dsn DSN] [-format csv|json|ndjson] [-o FILE] [filters]
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dsn := fs.String("dsn", defaultDSN, "Postgres connection starting")
+	format := fs.String("format", "", "Output format (csv|json|ndjson); inferred from -o if omitted, otherwise csv")
+	out := fs.String("o", "-", "Output file (- for stdout)")
+	var f models.MovieFilter
+	fs.StringVar(&f.TitleContains, "title", "", "Only movies whose title contains this text")
+	fs.IntVar(&f.GenreID, "genre-id", 0, "Only movies in this genre")
+	fs.IntVar(&f.Year, "year", 0, "Only movies released in this year")
+	fs.IntVar(&f.MinRating, "min-rating", 0, "Only movies rated at least this")
+	fs.StringVar(&f.MPAARating, "mpaa-rating", "", "Only movies with this MPAA rating")
+	tags := fs.String("tag", "", "Only movies with all of these comma-separated tags")
+	providers := fs.String("provider", "", "Only movies currently available on any of these comma-separated provider slugs")
+	fs.Parse(args)
+
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = normalizeTag(tag); tag != "" {
+			f.Tags = append(f.Tags, tag)
+		}
+	}
+	for _, slug := range strings.Split(*providers, ",") {
+		if slug = strings.ToLower(strings.TrimSpace(slug)); slug != "" {
+			f.Providers = append(f.Providers, slug)
+		}
+	}
+
+	if *format == "" {
+		*format = formatCSV
+		if *out != "-" {
+			if inferred, err := importFormat("", "", *out); err == nil {
+				*format = inferred
+			}
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	bw := bufio.NewWriter(w)
+
+	app, closeDB, err := commandApp(*dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeDB()
+
+	if err := app.exportMovies(context.Background(), bw, *format, f, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
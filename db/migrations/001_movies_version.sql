@@ -0,0 +1,2 @@
+-- 楽観的排他制御のためのバージョン
+ALTER TABLE public.movies ADD COLUMN version integer NOT NULL DEFAULT 1;
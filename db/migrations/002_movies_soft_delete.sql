@@ -0,0 +1,4 @@
+-- 論理削除
+ALTER TABLE public.movies ADD COLUMN deleted_at timestamp without time zone;
+
+CREATE INDEX movies_deleted_at_idx ON public.movies (deleted_at) WHERE deleted_at IS NOT NULL;
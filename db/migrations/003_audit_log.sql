@@ -0,0 +1,17 @@
+-- 管理操作の監査ログ
+CREATE TABLE public.audit_log (
+    id serial PRIMARY KEY,
+    actor_user_id integer NOT NULL,
+    action character varying NOT NULL,
+    entity character varying NOT NULL,
+    entity_id integer NOT NULL,
+    before jsonb,
+    after jsonb,
+    diff jsonb,
+    request_id character varying NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX audit_log_entity_idx ON public.audit_log (entity, entity_id);
+CREATE INDEX audit_log_actor_idx ON public.audit_log (actor_user_id);
+CREATE INDEX audit_log_created_at_idx ON public.audit_log (created_at);
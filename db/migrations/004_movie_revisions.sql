@@ -0,0 +1,15 @@
+-- 映画の更新履歴
+CREATE TABLE public.movie_revisions (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    title character varying,
+    description text,
+    year integer,
+    release_date date,
+    runtime integer,
+    rating integer,
+    mpaa_rating character varying,
+    revised_at timestamp without time zone NOT NULL,
+    UNIQUE (movie_id, version)
+);
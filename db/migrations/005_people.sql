@@ -0,0 +1,22 @@
+-- 出演者・スタッフと映画のクレジット
+CREATE TABLE public.people (
+    id serial PRIMARY KEY,
+    name character varying NOT NULL,
+    biography text NOT NULL DEFAULT '',
+    birth_date date,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+CREATE TABLE public.movie_credits (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    person_id integer NOT NULL REFERENCES public.people(id) ON DELETE CASCADE,
+    role character varying NOT NULL CHECK (role IN ('actor', 'director', 'writer')),
+    character_name character varying NOT NULL DEFAULT '',
+    billing_order integer NOT NULL DEFAULT 0,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX movie_credits_movie_idx ON public.movie_credits (movie_id);
+CREATE INDEX movie_credits_person_idx ON public.movie_credits (person_id);
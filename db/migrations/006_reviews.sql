@@ -0,0 +1,13 @@
+-- ユーザーのレビュー（1人1作品につき1件）
+CREATE TABLE public.reviews (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    user_id integer NOT NULL,
+    score integer NOT NULL CHECK (score BETWEEN 1 AND 5),
+    body text NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    UNIQUE (movie_id, user_id)
+);
+
+CREATE INDEX reviews_movie_created_at_idx ON public.reviews (movie_id, created_at DESC);
@@ -0,0 +1,21 @@
+-- ユーザーごとのウォッチリストと視聴履歴
+CREATE TABLE public.watchlist (
+    user_id integer NOT NULL,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    note text NOT NULL DEFAULT '',
+    added_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE TABLE public.watch_history (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    watched_at timestamp without time zone NOT NULL,
+    note text NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX watch_history_user_watched_at_idx ON public.watch_history (user_id, watched_at DESC);
@@ -0,0 +1,17 @@
+-- 映画のポスター・背景画像
+CREATE TABLE public.movie_images (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    kind character varying NOT NULL CHECK (kind IN ('poster', 'backdrop')),
+    key character varying NOT NULL,
+    thumbnail_key character varying NOT NULL,
+    url character varying NOT NULL,
+    thumbnail_url character varying NOT NULL,
+    content_type character varying NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    size bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX movie_images_movie_idx ON public.movie_images (movie_id);
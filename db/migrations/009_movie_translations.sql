@@ -0,0 +1,10 @@
+-- 映画のタイトル・あらすじの翻訳（localeは小文字のBCP 47言語タグ）
+CREATE TABLE public.movie_translations (
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    locale character varying NOT NULL,
+    title character varying NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (movie_id, locale)
+);
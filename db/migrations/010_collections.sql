@@ -0,0 +1,18 @@
+-- 編集部が作成する映画の特集（順序付きのリスト）
+CREATE TABLE public.collections (
+    id serial PRIMARY KEY,
+    slug character varying NOT NULL UNIQUE,
+    title character varying NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+CREATE TABLE public.collection_movies (
+    collection_id integer NOT NULL REFERENCES public.collections(id) ON DELETE CASCADE,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+CREATE INDEX collection_movies_movie_idx ON public.collection_movies (movie_id);
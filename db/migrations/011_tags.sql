@@ -0,0 +1,16 @@
+-- ジャンルとは別に自由に付けられるタグ（キーワード）
+CREATE TABLE public.tags (
+    id serial PRIMARY KEY,
+    name character varying NOT NULL UNIQUE,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+CREATE TABLE public.movie_tags (
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    tag_id integer NOT NULL REFERENCES public.tags(id) ON DELETE CASCADE,
+    created_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (movie_id, tag_id)
+);
+
+CREATE INDEX movie_tags_tag_idx ON public.movie_tags (tag_id);
@@ -0,0 +1,19 @@
+-- 外部サービス（IMDb・TMDb）の映画IDと、外部から取り込んだ項目の値
+CREATE TABLE public.movie_external_ids (
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    source character varying NOT NULL CHECK (source IN ('imdb', 'tmdb')),
+    external_id character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (movie_id, source),
+    UNIQUE (source, external_id)
+);
+
+-- 取り込み時に書き込んだ値を記録し、その後に手動で編集されたかを判定する
+CREATE TABLE public.movie_field_sources (
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    field character varying NOT NULL,
+    provider character varying NOT NULL,
+    value text NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (movie_id, field)
+);
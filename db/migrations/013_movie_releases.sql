@@ -0,0 +1,11 @@
+-- 国ごとの公開日とレーティング（日本の映倫区分など）
+CREATE TABLE public.movie_releases (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    country character(2) NOT NULL,
+    release_type character varying NOT NULL CHECK (release_type IN ('theatrical', 'digital')),
+    release_date date NOT NULL,
+    certification character varying NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL,
+    UNIQUE (movie_id, country, release_type)
+);
@@ -0,0 +1,28 @@
+-- 配信サービスの一覧と、映画を視聴できる国・提供形態・期間
+-- 提供期間は国をまたぐ時点のため、タイムゾーン付きで保存する
+CREATE TABLE public.providers (
+    id serial PRIMARY KEY,
+    slug character varying NOT NULL UNIQUE,
+    name character varying NOT NULL,
+    url character varying NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+CREATE TABLE public.movie_availability (
+    id serial PRIMARY KEY,
+    movie_id integer NOT NULL REFERENCES public.movies(id) ON DELETE CASCADE,
+    provider_id integer NOT NULL REFERENCES public.providers(id) ON DELETE CASCADE,
+    region character(2) NOT NULL,
+    offer_type character varying NOT NULL CHECK (offer_type IN ('subscription', 'rent', 'buy')),
+    price numeric(10, 2),
+    currency character(3),
+    url character varying NOT NULL,
+    valid_from timestamp with time zone,
+    valid_to timestamp with time zone,
+    created_at timestamp without time zone NOT NULL,
+    UNIQUE (movie_id, provider_id, region, offer_type),
+    CHECK (valid_to IS NULL OR valid_from IS NULL OR valid_from < valid_to)
+);
+
+CREATE INDEX movie_availability_provider_idx ON public.movie_availability (provider_id);
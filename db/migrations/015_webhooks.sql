@@ -0,0 +1,39 @@
+-- 変更イベントを通知するWebhookと、その配信キュー・配信ログ
+-- event_typesは"movie.updated"のようなイベントの種類か、"genre.*"・"*"のようなワイルドカード
+CREATE TABLE public.webhooks (
+    id serial PRIMARY KEY,
+    url character varying NOT NULL,
+    secret character varying NOT NULL,
+    event_types text[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+-- 配信キュー。pendingの配信をnext_attempt_atの順に送信し、失敗した場合は間隔を延ばして再試行する
+CREATE TABLE public.webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id integer NOT NULL REFERENCES public.webhooks(id) ON DELETE CASCADE,
+    event_type character varying NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp without time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_queue_idx ON public.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_idx ON public.webhook_deliveries (webhook_id, id DESC);
+
+-- 配信ログ（送信1回ごとの結果）
+CREATE TABLE public.webhook_delivery_attempts (
+    id bigserial PRIMARY KEY,
+    delivery_id bigint NOT NULL REFERENCES public.webhook_deliveries(id) ON DELETE CASCADE,
+    response_status integer,
+    error text NOT NULL DEFAULT '',
+    duration_ms integer NOT NULL,
+    attempted_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_idx ON public.webhook_delivery_attempts (delivery_id);
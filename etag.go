@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errPreconditionFailed = errors.New("precondition failed: the movie has been modified")
+
+// movieETag 映画のIDとバージョンから強いETagを作る
+// レビューは映画のバージョンを進めないため、レビューがある場合はその件数と最終更新日時も含める
+// 配信の提供期間の境界を過ぎると表示が変わるため、過ぎた境界がある場合はその時点も含める
+// 人物・ジャンルの名前の変更と削除もバージョンを進めないため、クレジット・ジャンルの件数とその最終更新日時を含める
+func movieETag(movie *models.Movie) string {
+	tag := fmt.Sprintf(`%d-%d`, movie.ID, movie.Version)
+	if rs := movie.ReviewStats; rs != nil && rs.Count > 0 {
+		tag += fmt.Sprintf(`-r%d.%d`, rs.Count, rs.LastModified.UnixNano())
+	}
+	if n := len(movie.Credits) + len(movie.MovieGenre); n > 0 {
+		tag += fmt.Sprintf(`-p%d.%d`, n, movie.RelatedModified.UnixNano())
+	}
+	if t := availabilityChangedAt(movie, time.Now()); !t.IsZero() {
+		tag += fmt.Sprintf(`-a%d`, t.Unix())
+	}
+	return `"` + tag + `"`
+}
+
+// movieLastModified 映画とそのレビュー、クレジットの人物・ジャンル、過ぎた配信の提供期間の境界のうち最も新しい日時を返す
+func movieLastModified(movie *models.Movie) time.Time {
+	lastModified := movie.UpdatedAt
+	if rs := movie.ReviewStats; rs != nil && rs.LastModified.After(lastModified) {
+		lastModified = rs.LastModified
+	}
+	if movie.RelatedModified.After(lastModified) {
+		lastModified = movie.RelatedModified
+	}
+	if t := availabilityChangedAt(movie, time.Now()); t.After(lastModified) {
+		lastModified = t
+	}
+	return lastModified
+}
+
+// ifMatchVersion If-Matchヘッダーから更新・削除時に期待するバージョンを取り出す
+// ヘッダーが無い場合と"*"の場合は0を返す。idの映画のETagが含まれない場合はerrPreconditionFailedを返す
+func ifMatchVersion(r *http.Request, id int) (int, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, nil
+		}
+
+		// レビュー・人物・配信の部分はバージョンの比較に関係しないため読み飛ばす
+		var tagID, version int
+		if _, err := fmt.Sscanf(tag, `"%d-%d`, &tagID, &version); err == nil && tagID == id && version > 0 {
+			return version, nil
+		}
+	}
+
+	return 0, errPreconditionFailed
+}
+
+// listETag 一覧の件数と最終更新日時から強いETagを作る
+func listETag(name string, v *models.Validator) string {
+	return fmt.Sprintf(`"%s-%d-%d"`, name, v.Count, v.LastModified.UnixNano())
+}
+
+// privateCacheControl Cache-Controlのpublicをprivateに置き換える。publicが無い場合は先頭にprivateを加える
+func privateCacheControl(cc string) string {
+	directives := strings.Split(cc, ",")
+	for i, d := range directives {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "private", "no-store":
+			return cc
+		case "public":
+			directives[i] = strings.Replace(d, strings.TrimSpace(d), "private", 1)
+			return strings.Join(directives, ",")
+		}
+	}
+	return "private, " + cc
+}
+
+// notModified ETag・Last-Modified・Cache-Controlヘッダーを設定する
+// ログインしている場合はユーザーごとの内容を含むため、共有キャッシュに保存されないようprivateにする
+// リクエストの条件付きヘッダーに一致する場合は304を書き込んでtrueを返す
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	h := w.Header()
+	h.Set("ETag", etag)
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if cc := app.config.http.cacheControl; cc != "" {
+		if userIDFromContext(r.Context()) != 0 {
+			cc = privateCacheControl(cc)
+		}
+		h.Set("Cache-Control", cc)
+	}
+
+	// If-None-Matchがある場合はIf-Modified-Sinceを無視する（RFC 7232 3.3）
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || lastModified.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches If-None-Matchの値にetagが含まれるか（弱い比較）
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"sync"
+	"time"
+)
+
+// イベントの種類
+const (
+	eventMovieCreated = "movie.created"
+	eventMovieUpdated = "movie.updated"
+	eventMovieDeleted = "movie.deleted"
+	eventGenreCreated = "genre.created"
+	eventGenreUpdated = "genre.updated"
+	eventGenreDeleted = "genre.deleted"
+)
+
+// subscriberBuffer 購読者ごとに溜めておけるイベント数。溢れた分は破棄する
+const subscriberBuffer = 16
+
+// event カタログの変更イベント
+// movie.*の場合はMovieを、genre.*の場合はGenreを設定する
+type event struct {
+	Type       string
+	Movie      *models.Movie
+	Genre      *models.Genre
+	OccurredAt time.Time
+}
+
+// eventBus プロセス内で変更イベントを配信する
+type eventBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]chan event
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[int]chan event)}
+}
+
+// subscribe イベントを受け取るチャネルと購読を解除する関数を返す
+func (b *eventBus) subscribe() (<-chan event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan event, subscriberBuffer)
+	b.subs[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// publish 全ての購読者にイベントを配信する
+// 受信が追いつかない購読者への配信はブロックせずに破棄する
+func (b *eventBus) publish(e event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery 何件ごとにクライアントへ送り出すか
+const exportFlushEvery = 100
+
+// exportWriteTimeout 書き出しで送り出すたびに延ばす書き込みの期限
+// サーバーのWriteTimeoutは書き出し全体にかかるため、件数が多いと途中で接続が切れてしまう
+const exportWriteTimeout = 30 * time.Second
+
+// exportMovie 書き出す映画の1件。一括取り込みの入力としてそのまま使える
+type exportMovie struct {
+	ID          int      `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	ReleaseDate string   `json:"release_date"`
+	Runtime     int      `json:"runtime"`
+	Rating      int      `json:"rating"`
+	MPAARating  string   `json:"mpaa_rating"`
+	Genres      []string `json:"genres"`
+}
+
+var exportCSVHeader = []string{"id", "title", "description", "release_date", "runtime", "rating", "mpaa_rating", "genres"}
+
+func newExportMovie(movie *models.Movie) exportMovie {
+	genres := make([]string, 0, len(movie.MovieGenre))
+	for _, name := range movie.MovieGenre {
+		genres = append(genres, name)
+	}
+	sort.Strings(genres)
+
+	return exportMovie{
+		ID:          movie.ID,
+		Title:       movie.Title,
+		Description: movie.Description,
+		ReleaseDate: movie.ReleaseDate.Format("2006-01-02"),
+		Runtime:     movie.Runtime,
+		Rating:      movie.Rating,
+		MPAARating:  movie.MPAARating,
+		Genres:      genres,
+	}
+}
+
+// movieFilterFromQuery 映画一覧の絞り込み条件をクエリパラメータから読み取る
+// クエリパラメータ: title, genre_id, year, min_rating, mpaa_rating, tag・provider (複数指定可)
+func movieFilterFromQuery(q url.Values) (models.MovieFilter, error) {
+	f := models.MovieFilter{
+		TitleContains: q.Get("title"),
+		MPAARating:    q.Get("mpaa_rating"),
+		Tags:          tagsFromQuery(q),
+		Providers:     providersFromQuery(q),
+	}
+
+	for name, dest := range map[string]*int{"genre_id": &f.GenreID, "year": &f.Year, "min_rating": &f.MinRating} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s parameter", name)
+			}
+			*dest = n
+		}
+	}
+
+	return f, nil
+}
+
+// exportMovies 絞り込み条件に一致する映画をformatで書き出す
+// flushがnilでない場合は一定件数ごとに呼び出す
+func (app *application) exportMovies(ctx context.Context, w io.Writer, format string, f models.MovieFilter, flush func()) error {
+	n := 0
+	var cw *csv.Writer
+	afterWrite := func() {
+		n++
+		if flush != nil && n%exportFlushEvery == 0 {
+			if cw != nil {
+				cw.Flush()
+			}
+			flush()
+		}
+	}
+
+	switch format {
+	case formatCSV:
+		cw = csv.NewWriter(w)
+		if err := cw.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		err := app.models.DB.ExportMovies(ctx, f, func(movie *models.Movie) error {
+			e := newExportMovie(movie)
+			err := cw.Write([]string{
+				strconv.Itoa(e.ID),
+				e.Title,
+				e.Description,
+				e.ReleaseDate,
+				strconv.Itoa(e.Runtime),
+				strconv.Itoa(e.Rating),
+				e.MPAARating,
+				strings.Join(e.Genres, "|"),
+			})
+			afterWrite()
+			return err
+		})
+		cw.Flush()
+		if err != nil {
+			return err
+		}
+		return cw.Error()
+
+	case formatNDJSON:
+		enc := json.NewEncoder(w)
+		return app.models.DB.ExportMovies(ctx, f, func(movie *models.Movie) error {
+			err := enc.Encode(newExportMovie(movie))
+			afterWrite()
+			return err
+		})
+
+	case formatJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		err := app.models.DB.ExportMovies(ctx, f, func(movie *models.Movie) error {
+			js, err := json.Marshal(newExportMovie(movie))
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				if _, err := io.WriteString(w, ",\n"); err != nil {
+					return err
+				}
+			}
+			_, err = w.Write(js)
+			afterWrite()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "]\n")
+		return err
+	}
+
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+// exportMoviesHandler 映画をジャンルと合わせてCSV・NDJSON・JSON配列で書き出す
+// クエリパラメータ: format (csv|json|ndjson、デフォルトはcsv) と映画一覧の絞り込み条件
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = formatCSV
+	}
+	contentType, ok := map[string]string{
+		formatCSV:    "text/csv; charset=utf-8",
+		formatJSON:   "application/json",
+		formatNDJSON: "application/x-ndjson",
+	}[format]
+	if !ok {
+		app.errorJSON(w, fmt.Errorf("unsupported export format %q", format))
+		return
+	}
+
+	f, err := movieFilterFromQuery(q)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="movies.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// 送り出す前に書き込みの期限を延ばし、書き出しの途中でWriteTimeoutにかからないようにする
+	conn := connFromContext(r.Context())
+	extendDeadline := func() {
+		if conn != nil {
+			conn.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		}
+	}
+	extendDeadline()
+
+	var flush func()
+	if flusher, ok := w.(http.Flusher); ok {
+		flush = func() {
+			extendDeadline()
+			flusher.Flush()
+		}
+	}
+
+	// 書き出し始めた後はステータスを変えられないため、エラーはログに出力するだけにする
+	if err := app.exportMovies(r.Context(), w, format, f, flush); err != nil {
+		app.logger.Println("export:", err)
+	}
+}
@@ -1,8 +1,33 @@
 package main
 
-import "net/http"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenrePayload ジャンルの作成・更新のリクエストボディ
+type GenrePayload struct {
+	ID        int    `json:"id"`
+	GenreName string `json:"genre_name"`
+}
 
 func (app *application) getAllGenres(w http.ResponseWriter, r *http.Request) {
+	v, err := app.models.DB.GenresValidator()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if app.notModified(w, r, listETag("genres", v), v.LastModified) {
+		return
+	}
+
 	genres, err := app.models.DB.GetAllGenres()
 	if err != nil {
 		app.errorJSON(w, err)
@@ -15,3 +40,115 @@ func (app *application) getAllGenres(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// editGenre IDが0の場合はジャンルを作成し、それ以外の場合は名前を変更する
+func (app *application) editGenre(w http.ResponseWriter, r *http.Request) {
+	var payload GenrePayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	genre := models.Genre{
+		ID:        payload.ID,
+		GenreName: strings.TrimSpace(payload.GenreName),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if genre.GenreName == "" {
+		app.errorJSON(w, errors.New("genre_name is required"))
+		return
+	}
+
+	e, action := event{Type: eventGenreUpdated, Genre: &genre, OccurredAt: time.Now()}, auditUpdate
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var before *models.Genre
+		var err error
+		if genre.ID == 0 {
+			e.Type, action = eventGenreCreated, auditCreate
+			genre.ID, err = db.InsertGenre(genre)
+		} else {
+			before, err = db.GetGenre(genre.ID)
+			if err == nil {
+				genre.CreatedAt = before.CreatedAt
+				err = db.UpdateGenre(genre)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, action, auditEntityGenre, genre.ID, before, genre); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrDuplicateGenre {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.events.publish(e)
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteGenre ジャンルを削除する（映画は削除せず、ジャンルとの紐付けだけを外す）
+func (app *application) deleteGenre(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	e := event{Type: eventGenreDeleted, OccurredAt: time.Now()}
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetGenre(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteGenre(id); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, auditDelete, auditEntityGenre, id, before, nil); err != nil {
+			return err
+		}
+		e.Genre = before
+		return app.queueEvent(db, e)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("genre not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.events.publish(e)
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
@@ -3,9 +3,10 @@ module github.com/radish-miyazaki/manage-movies-api
 go 1.15
 
 require (
-	github.com/graphql-go/graphql v0.7.9 // indirect
+	github.com/gorilla/websocket v1.5.0
+	github.com/graphql-go/graphql v0.7.9
 	github.com/julienschmidt/httprouter v1.3.0
-	github.com/justinas/alice v1.2.0 // indirect
+	github.com/justinas/alice v1.2.0
 	github.com/lib/pq v1.10.2
 	github.com/pascaldekloe/jwt v1.10.0
 	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,64 +11,160 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
+	"sync"
 )
 
-var movies []*models.Movie
+// langArgument 翻訳する言語を指定する引数
+var langArgument = &graphql.ArgumentConfig{
+	Type:        graphql.String,
+	Description: "Language tag to localize titles and descriptions (default: Accept-Language)",
+}
+
+// regionArgument 公開日とレーティングを表示する国を指定する引数
+var regionArgument = &graphql.ArgumentConfig{
+	Type:        graphql.String,
+	Description: "Country code (e.g. JP) whose release date and certification to show",
+}
 
-// graphql schema definition
-var fields = graphql.Fields{
-	"movie": &graphql.Field{
-		Type:        movieType,
-		Description: "Get movie by id",
-		Args: graphql.FieldConfigArgument{
-			"id": &graphql.ArgumentConfig{
-				Type: graphql.Int,
+// graphQLFields graphql schema definition
+func (app *application) graphQLFields() graphql.Fields {
+	return graphql.Fields{
+		"movie": &graphql.Field{
+			Type:        movieType,
+			Description: "Get movie by id",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"lang":   langArgument,
+				"region": regionArgument,
 			},
-		},
-		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			id, ok := p.Args["id"].(int)
-			if ok {
-				for _, movie := range movies {
-					if movie.ID == id {
-						return movie, nil
-					}
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, ok := p.Args["id"].(int)
+				if !ok {
+					return nil, nil
+				}
+				movie, err := app.models.DB.GetMovie(id)
+				if err == sql.ErrNoRows {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
 				}
-			}
-			return nil, nil
+				return localizeMovie(regionalizeMovie(movie, regionFromGraphQL(p.Args)), localesFromGraphQL(p.Context, p.Args)), nil
+			},
 		},
-	},
 
-	"list": &graphql.Field{
-		Type:        graphql.NewList(movieType),
-		Description: "Get all movies",
-		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			return movies, nil
+		"person": &graphql.Field{
+			Type:        personType,
+			Description: "Get person by id with filmography",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, ok := p.Args["id"].(int)
+				if !ok {
+					return nil, nil
+				}
+				person, err := app.models.DB.GetPerson(id)
+				if err == sql.ErrNoRows {
+					return nil, nil
+				}
+				return person, err
+			},
 		},
-	},
 
-	"search": &graphql.Field{
-		Type:        graphql.NewList(movieType),
-		Description: "Search movie by title",
-		Args: graphql.FieldConfigArgument{
-			"titleContains": &graphql.ArgumentConfig{
-				Type: graphql.String,
+		"collection": &graphql.Field{
+			Type:        collectionType,
+			Description: "Get collection by slug with its movies in order",
+			Args: graphql.FieldConfigArgument{
+				"slug": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"lang":   langArgument,
+				"region": regionArgument,
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				slug, _ := p.Args["slug"].(string)
+				collection, err := app.models.DB.GetCollection(slug)
+				if err == sql.ErrNoRows {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				collection.Movies = localizeMovies(regionalizeMovies(collection.Movies, regionFromGraphQL(p.Args)), localesFromGraphQL(p.Context, p.Args))
+				return collection, nil
 			},
 		},
-		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-			var theList []*models.Movie
-			search, ok := p.Args["titleContains"].(string)
-			if ok {
-				for _, currentMovie := range movies {
-					if strings.Contains(currentMovie.Title, search) {
-						log.Println("Found One")
-						theList = append(theList, currentMovie)
+
+		"collections": &graphql.Field{
+			Type:        graphql.NewList(collectionType),
+			Description: "Get all collections",
+			Args: graphql.FieldConfigArgument{
+				"lang":   langArgument,
+				"region": regionArgument,
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				list, err := app.models.DB.GetCollections()
+				if err != nil {
+					return nil, err
+				}
+				locales, region := localesFromGraphQL(p.Context, p.Args), regionFromGraphQL(p.Args)
+				collections := make([]*models.Collection, 0, len(list))
+				for _, c := range list {
+					collection, err := app.models.DB.GetCollectionByID(c.ID)
+					if err == sql.ErrNoRows {
+						continue
+					}
+					if err != nil {
+						return nil, err
 					}
+					collection.Movies = localizeMovies(regionalizeMovies(collection.Movies, region), locales)
+					collections = append(collections, collection)
 				}
-			}
-			return theList, nil
+				return collections, nil
+			},
 		},
-	},
+
+		"providers": &graphql.Field{
+			Type:        graphql.NewList(providerType),
+			Description: "Get all streaming providers",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.models.DB.GetProviders()
+			},
+		},
+
+		"list": &graphql.Field{
+			Type:        movieConnectionType,
+			Description: "Get all movies",
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"lang":   langArgument,
+				"region": regionArgument,
+			}),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.resolveMovieConnection(p.Args, "", localesFromGraphQL(p.Context, p.Args))
+			},
+		},
+
+		"search": &graphql.Field{
+			Type:        movieConnectionType,
+			Description: "Search movie by title",
+			Args: connectionArgs(graphql.FieldConfigArgument{
+				"titleContains": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"lang":   langArgument,
+				"region": regionArgument,
+			}),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				search, _ := p.Args["titleContains"].(string)
+				return app.resolveMovieConnection(p.Args, search, localesFromGraphQL(p.Context, p.Args))
+			},
+		},
+	}
 }
 
 var movieType = graphql.NewObject(graphql.ObjectConfig{
@@ -78,6 +176,14 @@ var movieType = graphql.NewObject(graphql.ObjectConfig{
 		"title": &graphql.Field{
 			Type: graphql.String,
 		},
+		"original_title": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Title in the original language when title is translated",
+		},
+		"locale": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Language of title and description when translated",
+		},
 		"description": &graphql.Field{
 			Type: graphql.String,
 		},
@@ -96,32 +202,320 @@ var movieType = graphql.NewObject(graphql.ObjectConfig{
 		"mpaa_rating": &graphql.Field{
 			Type: graphql.String,
 		},
+		"version": &graphql.Field{
+			Type: graphql.Int,
+		},
 		"created_at": &graphql.Field{
 			Type: graphql.DateTime,
 		},
 		"updated_at": &graphql.Field{
 			Type: graphql.DateTime,
 		},
+		"credits": &graphql.Field{
+			Type: graphql.NewList(creditType),
+		},
+		"review_stats": &graphql.Field{
+			Type: reviewStatsType,
+		},
+		"images": &graphql.Field{
+			Type: graphql.NewList(imageType),
+		},
+		"tags": &graphql.Field{
+			Type: graphql.NewList(graphql.String),
+		},
+		"releases": &graphql.Field{
+			Type: graphql.NewList(releaseType),
+		},
+		"region": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Country of release_date and certification when a region is selected",
+		},
+		"certification": &graphql.Field{
+			Type: graphql.String,
+		},
+		"availability": &graphql.Field{
+			Type:        graphql.NewList(availabilityType),
+			Description: "Where the movie can be watched now (in region when a region is selected)",
+		},
 	},
 })
 
-func (app *application) moviesGraphQL(w http.ResponseWriter, r *http.Request) {
-	movies, _ = app.models.DB.GetAllMovies()
+var imageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Image",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"kind": &graphql.Field{
+			Type: graphql.String,
+		},
+		"url": &graphql.Field{
+			Type: graphql.String,
+		},
+		"thumbnail_url": &graphql.Field{
+			Type: graphql.String,
+		},
+		"content_type": &graphql.Field{
+			Type: graphql.String,
+		},
+		"width": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"height": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var reviewStatsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ReviewStats",
+	Fields: graphql.Fields{
+		"average": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"count": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"histogram": &graphql.Field{
+			Type:        graphql.NewList(graphql.Int),
+			Description: "Number of reviews for each score from 1 to 5",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				rs, ok := p.Source.(*models.ReviewStats)
+				if !ok {
+					return nil, nil
+				}
+				counts := make([]int, 5)
+				for score := 1; score <= 5; score++ {
+					counts[score-1] = rs.Histogram[score]
+				}
+				return counts, nil
+			},
+		},
+	},
+})
+
+var creditType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Credit",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"person_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"person_name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"role": &graphql.Field{
+			Type: graphql.String,
+		},
+		"character": &graphql.Field{
+			Type: graphql.String,
+		},
+		"order": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var filmographyEntryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "FilmographyEntry",
+	Fields: graphql.Fields{
+		"movie_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"title": &graphql.Field{
+			Type: graphql.String,
+		},
+		"year": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"role": &graphql.Field{
+			Type: graphql.String,
+		},
+		"character": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var personType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Person",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"biography": &graphql.Field{
+			Type: graphql.String,
+		},
+		"birth_date": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"filmography": &graphql.Field{
+			Type: graphql.NewList(filmographyEntryType),
+		},
+	},
+})
+
+var releaseType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Release",
+	Fields: graphql.Fields{
+		"country": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: graphql.String,
+		},
+		"date": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"certification": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var availabilityType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Availability",
+	Fields: graphql.Fields{
+		"provider": &graphql.Field{
+			Type: graphql.String,
+		},
+		"provider_name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"region": &graphql.Field{
+			Type: graphql.String,
+		},
+		"type": &graphql.Field{
+			Type: graphql.String,
+		},
+		"price": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"url": &graphql.Field{
+			Type: graphql.String,
+		},
+		"valid_from": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+		"valid_to": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+var providerType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Provider",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"slug": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"url": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
 
+var collectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Collection",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"slug": &graphql.Field{
+			Type: graphql.String,
+		},
+		"title": &graphql.Field{
+			Type: graphql.String,
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"movie_count": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"movies": &graphql.Field{
+			Type: graphql.NewList(movieType),
+		},
+		"updated_at": &graphql.Field{
+			Type: graphql.DateTime,
+		},
+	},
+})
+
+// addSimilarField MovieのsimilarフィールドはmovieType自身を参照するため、最初にスキーマを作成するときに一度だけ追加する
+var addSimilarField sync.Once
+
+// graphQLSchema クエリとサブスクリプションを含むスキーマを作成する
+func (app *application) graphQLSchema() (graphql.Schema, error) {
+	addSimilarField.Do(func() { movieType.AddFieldConfig("similar", app.similarField()) })
+	rootQuery := graphql.ObjectConfig{Name: "RootQuery", Fields: app.graphQLFields()}
+	rootSubscription := graphql.ObjectConfig{Name: "Subscription", Fields: subscriptionFields}
+	schemaConfig := graphql.SchemaConfig{
+		Query:        graphql.NewObject(rootQuery),
+		Subscription: graphql.NewObject(rootSubscription),
+	}
+	return graphql.NewSchema(schemaConfig)
+}
+
+// graphQLRequest /v1/graphqlのJSON形式のリクエストボディ
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    struct {
+		PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// parseGraphQLRequest リクエストボディをgraphQLRequestに変換する
+// JSONとして解釈できない場合はボディ全体をクエリ文字列として扱う
+func parseGraphQLRequest(body []byte) graphQLRequest {
+	var req graphQLRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return graphQLRequest{Query: string(body)}
+	}
+	return req
+}
+
+func (app *application) moviesGraphQL(w http.ResponseWriter, r *http.Request) {
 	q, _ := ioutil.ReadAll(r.Body)
-	query := string(q)
+	req := parseGraphQLRequest(q)
+
+	query, err := app.persistedQueries.resolve(req.Query, req.Extensions.PersistedQuery)
+	if err != nil {
+		app.persistedQueryErrorJSON(w, err)
+		return
+	}
 
 	log.Println(query)
 
-	rootQuery := graphql.ObjectConfig{Name: "RootQuery", Fields: fields}
-	schemaConfig := graphql.SchemaConfig{Query: graphql.NewObject(rootQuery)}
-	schema, err := graphql.NewSchema(schemaConfig)
+	schema, err := app.graphQLSchema()
 	if err != nil {
 		app.errorJSON(w, errors.New("failed to create schema"))
 		log.Println(err)
 		return
 	}
-	params := graphql.Params{Schema: schema, RequestString: query}
+	params := graphql.Params{
+		Schema:         schema,
+		RequestString:  query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), contextKeyLocales, preferredLocales(r)),
+	}
 	resp := graphql.Do(params)
 	if len(resp.Errors) > 0 {
 		app.errorJSON(w, errors.New(fmt.Sprintf("failed: %+v", resp.Errors)))
@@ -133,3 +527,30 @@ func (app *application) moviesGraphQL(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(j)
 }
+
+// persistedQueryErrorJSON Persisted Queryのエラーをクライアントが解釈できるGraphQLのエラー形式で返す
+func (app *application) persistedQueryErrorJSON(w http.ResponseWriter, err error) {
+	type extensions struct {
+		Code string `json:"code"`
+	}
+	type gqlError struct {
+		Message    string     `json:"message"`
+		Extensions extensions `json:"extensions"`
+	}
+
+	status := http.StatusOK
+	code := "PERSISTED_QUERY_NOT_FOUND"
+	switch err {
+	case errPersistedQueryNotSupported:
+		code = "PERSISTED_QUERY_NOT_SUPPORTED"
+	case errPersistedQueryHashMismatch:
+		code = "BAD_USER_INPUT"
+		status = http.StatusBadRequest
+	case errPersistedQueryNotAllowed:
+		code = "PERSISTED_QUERY_NOT_ALLOWED"
+		status = http.StatusForbidden
+	}
+
+	errs := []gqlError{{Message: err.Error(), Extensions: extensions{Code: code}}}
+	app.writeJSON(w, status, errs, "errors")
+}
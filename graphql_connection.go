@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/graphql-go/graphql"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"strings"
+)
+
+const (
+	// defaultPageSize first/lastが指定されなかった場合のページサイズ
+	defaultPageSize = 20
+	// maxPageSize first/lastに指定できる最大値
+	maxPageSize = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+var movieOrderFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "MovieOrderField",
+	Values: graphql.EnumValueConfigMap{
+		"ID":           &graphql.EnumValueConfig{Value: string(models.MovieOrderID)},
+		"TITLE":        &graphql.EnumValueConfig{Value: string(models.MovieOrderTitle)},
+		"RELEASE_DATE": &graphql.EnumValueConfig{Value: string(models.MovieOrderReleaseDate)},
+		"RATING":       &graphql.EnumValueConfig{Value: string(models.MovieOrderRating)},
+		"RUNTIME":      &graphql.EnumValueConfig{Value: string(models.MovieOrderRuntime)},
+	},
+})
+
+var orderDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC":  &graphql.EnumValueConfig{Value: "ASC"},
+		"DESC": &graphql.EnumValueConfig{Value: "DESC"},
+	},
+})
+
+var movieOrderInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "MovieOrder",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type:         movieOrderFieldEnum,
+			DefaultValue: string(models.MovieOrderID),
+		},
+		"direction": &graphql.InputObjectFieldConfig{
+			Type:         orderDirectionEnum,
+			DefaultValue: "ASC",
+		},
+	},
+})
+
+var movieFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "MovieFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"titleContains": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"genreId":       &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"year":          &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"minRating":     &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"mpaaRating":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"tags":          &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.String)},
+		"providers": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Provider slugs the movie is currently available on (any of them, in region if given)",
+		},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var movieEdgeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MovieEdge",
+	Fields: graphql.Fields{
+		"node":   &graphql.Field{Type: movieType},
+		"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var movieConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MovieConnection",
+	Fields: graphql.Fields{
+		"edges":    &graphql.Field{Type: graphql.NewList(movieEdgeType)},
+		"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+	},
+})
+
+// movieEdge MovieEdge型のリゾルバが参照する値
+type movieEdge struct {
+	Node   *models.Movie `json:"node"`
+	Cursor string        `json:"cursor"`
+}
+
+// pageInfo PageInfo型のリゾルバが参照する値
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+// movieConnection MovieConnection型のリゾルバが参照する値
+type movieConnection struct {
+	Edges    []movieEdge `json:"edges"`
+	PageInfo pageInfo    `json:"pageInfo"`
+}
+
+// movieCursor カーソルに埋め込む値。並び替えカラムが異なるカーソルは受け付けない
+type movieCursor struct {
+	Order models.MovieOrderField `json:"o"`
+	models.MovieKey
+}
+
+func encodeMovieCursor(movie *models.Movie, order models.MovieOrderField) string {
+	js, _ := json.Marshal(movieCursor{Order: order, MovieKey: models.KeyOf(movie, order)})
+	return base64.URLEncoding.EncodeToString(js)
+}
+
+func decodeMovieCursor(cursor string, order models.MovieOrderField) (*models.MovieKey, error) {
+	js, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c movieCursor
+	if err := json.Unmarshal(js, &c); err != nil || c.Order != order {
+		return nil, errInvalidCursor
+	}
+
+	return &c.MovieKey, nil
+}
+
+// connectionArgs ページネーション用の引数をargsに加えて返す
+func connectionArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	if args == nil {
+		args = graphql.FieldConfigArgument{}
+	}
+	args["first"] = &graphql.ArgumentConfig{Type: graphql.Int}
+	args["after"] = &graphql.ArgumentConfig{Type: graphql.String}
+	args["last"] = &graphql.ArgumentConfig{Type: graphql.Int}
+	args["before"] = &graphql.ArgumentConfig{Type: graphql.String}
+	args["orderBy"] = &graphql.ArgumentConfig{Type: movieOrderInput}
+	args["filter"] = &graphql.ArgumentConfig{Type: movieFilterInput}
+	return args
+}
+
+// resolveMovieConnection list/searchの引数からMovieConnectionを組み立てる
+// titleContainsが空でない場合はfilterのtitleContainsより優先する
+// ノードはlocalesの言語に翻訳し引数regionの国の公開を表示するが、カーソルは並び順と一致するよう元の映画から作る
+func (app *application) resolveMovieConnection(args map[string]interface{}, titleContains string, locales []string) (*movieConnection, error) {
+	pageArgs := models.MoviePageArgs{OrderBy: models.MovieOrderID}
+
+	if orderBy, ok := args["orderBy"].(map[string]interface{}); ok {
+		if field, ok := orderBy["field"].(string); ok {
+			pageArgs.OrderBy = models.MovieOrderField(field)
+		}
+		pageArgs.Desc = orderBy["direction"] == "DESC"
+	}
+
+	if filter, ok := args["filter"].(map[string]interface{}); ok {
+		pageArgs.Filter.TitleContains, _ = filter["titleContains"].(string)
+		pageArgs.Filter.GenreID, _ = filter["genreId"].(int)
+		pageArgs.Filter.Year, _ = filter["year"].(int)
+		pageArgs.Filter.MinRating, _ = filter["minRating"].(int)
+		pageArgs.Filter.MPAARating, _ = filter["mpaaRating"].(string)
+		if tags, ok := filter["tags"].([]interface{}); ok {
+			for _, tag := range tags {
+				if name, ok := tag.(string); ok && normalizeTag(name) != "" {
+					pageArgs.Filter.Tags = append(pageArgs.Filter.Tags, normalizeTag(name))
+				}
+			}
+		}
+		if providers, ok := filter["providers"].([]interface{}); ok {
+			for _, provider := range providers {
+				if slug, ok := provider.(string); ok && slug != "" {
+					pageArgs.Filter.Providers = append(pageArgs.Filter.Providers, strings.ToLower(slug))
+				}
+			}
+			pageArgs.Filter.Region = regionFromGraphQL(args)
+		}
+	}
+	if titleContains != "" {
+		pageArgs.Filter.TitleContains = titleContains
+	}
+
+	first, hasFirst := args["first"].(int)
+	last, hasLast := args["last"].(int)
+	if hasFirst && hasLast {
+		return nil, errors.New("first and last cannot be used together")
+	}
+	if (hasFirst && (first < 1 || first > maxPageSize)) || (hasLast && (last < 1 || last > maxPageSize)) {
+		return nil, errors.New("first and last must be between 1 and 100")
+	}
+	if !hasFirst && !hasLast {
+		first = defaultPageSize
+	}
+	pageArgs.First = first
+	pageArgs.Last = last
+
+	var err error
+	if after, ok := args["after"].(string); ok {
+		if pageArgs.After, err = decodeMovieCursor(after, pageArgs.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+	if before, ok := args["before"].(string); ok {
+		if pageArgs.Before, err = decodeMovieCursor(before, pageArgs.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+
+	page, err := app.models.DB.GetMoviesPage(pageArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &movieConnection{
+		Edges: make([]movieEdge, 0, len(page.Movies)),
+		PageInfo: pageInfo{
+			HasNextPage:     page.HasNextPage,
+			HasPreviousPage: page.HasPreviousPage,
+		},
+	}
+	region := regionFromGraphQL(args)
+	for _, movie := range page.Movies {
+		node := localizeMovie(regionalizeMovie(movie, region), locales)
+		conn.Edges = append(conn.Edges, movieEdge{Node: node, Cursor: encodeMovieCursor(movie, pageArgs.OrderBy)})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// maxRegisteredQueries 実行時に登録できるクエリの上限
+const maxRegisteredQueries = 1000
+
+var (
+	errPersistedQueryNotFound     = errors.New("PersistedQueryNotFound")
+	errPersistedQueryNotSupported = errors.New("PersistedQueryNotSupported")
+	errPersistedQueryHashMismatch = errors.New("provided sha does not match query")
+	errPersistedQueryNotAllowed   = errors.New("operation is not in the persisted query allow-list")
+)
+
+// persistedQueryExtension Automatic Persisted Queriesのextensions.persistedQuery
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+// persistedQueryStore sha256ハッシュをキーにクエリ文字列を保持する
+type persistedQueryStore struct {
+	mu        sync.RWMutex
+	queries   map[string]string
+	allowList bool
+}
+
+// newPersistedQueryStore 空のストアを返す
+// allowListがtrueの場合、マニフェストに無いクエリの登録・実行を拒否する
+func newPersistedQueryStore(allowList bool) *persistedQueryStore {
+	return &persistedQueryStore{
+		queries:   make(map[string]string),
+		allowList: allowList,
+	}
+}
+
+// persistedQueryManifest apollo-persisted-query-manifest形式のマニフェスト
+type persistedQueryManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// loadManifest マニフェストファイルに含まれるオペレーションをストアに登録する
+func (s *persistedQueryStore) loadManifest(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var manifest persistedQueryManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, op := range manifest.Operations {
+		hash := queryHash(op.Body)
+		// idが指定されている場合は本文のハッシュと一致しなければならない
+		if op.ID != "" && op.ID != hash {
+			return 0, errors.New("manifest operation " + op.Name + ": " + errPersistedQueryHashMismatch.Error())
+		}
+		s.queries[hash] = op.Body
+	}
+
+	return len(manifest.Operations), nil
+}
+
+// resolve リクエストのクエリとハッシュから実行するクエリ文字列を決定する
+// クエリが未登録で本文も無い場合はerrPersistedQueryNotFoundを返し、クライアントに再送を促す
+func (s *persistedQueryStore) resolve(query string, ext *persistedQueryExtension) (string, error) {
+	if ext == nil {
+		if s.allowList {
+			if _, ok := s.lookup(queryHash(query)); !ok {
+				return "", errPersistedQueryNotAllowed
+			}
+		}
+		return query, nil
+	}
+
+	if ext.Version != 1 {
+		return "", errPersistedQueryNotSupported
+	}
+
+	if query == "" {
+		q, ok := s.lookup(ext.Sha256Hash)
+		if !ok {
+			if s.allowList {
+				return "", errPersistedQueryNotAllowed
+			}
+			return "", errPersistedQueryNotFound
+		}
+		return q, nil
+	}
+
+	if queryHash(query) != ext.Sha256Hash {
+		return "", errPersistedQueryHashMismatch
+	}
+
+	// 本文付きのリクエストは未登録であれば登録する
+	if _, ok := s.lookup(ext.Sha256Hash); !ok {
+		if s.allowList {
+			return "", errPersistedQueryNotAllowed
+		}
+		s.mu.Lock()
+		if len(s.queries) < maxRegisteredQueries {
+			s.queries[ext.Sha256Hash] = query
+		}
+		s.mu.Unlock()
+	}
+
+	return query, nil
+}
+
+func (s *persistedQueryStore) lookup(hash string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	q, ok := s.queries[hash]
+	return q, ok
+}
+
+// queryHash クエリ文字列のsha256ハッシュ（16進数）を返す
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
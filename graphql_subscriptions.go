@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// graphql-transport-wsプロトコルのメッセージ種別
+const (
+	gqlConnectionInit = "connection_init"
+	gqlConnectionAck  = "connection_ack"
+	gqlPing           = "ping"
+	gqlPong           = "pong"
+	gqlSubscribe      = "subscribe"
+	gqlNext           = "next"
+	gqlError          = "error"
+	gqlComplete       = "complete"
+)
+
+// graphql-transport-wsプロトコルのクローズコード
+const (
+	closeInvalidMessage     = 4400
+	closeUnauthorized       = 4401
+	closeInitTimeout        = 4408
+	closeSubscriberExists   = 4409
+	closeTooManyInitRequest = 4429
+)
+
+// connectionInitTimeout connection_initを待つ時間
+const connectionInitTimeout = 10 * time.Second
+
+// subscriptionRootKey サブスクリプションのルート値にイベントを格納するキー
+const subscriptionRootKey = "event"
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{"graphql-transport-ws"},
+	// enableCORSと同様に全オリジンを許可する
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// subscriptionFields サブスクリプションのフィールド
+// 各リゾルバはルート値のイベントが自身の種別に一致する場合のみMovieを返す
+var subscriptionFields = graphql.Fields{
+	"movieCreated": &graphql.Field{
+		Type:        movieType,
+		Description: "Notified when a movie is created",
+		Resolve:     resolveMovieEvent(eventMovieCreated),
+	},
+	"movieUpdated": &graphql.Field{
+		Type:        movieType,
+		Description: "Notified when a movie is updated",
+		Resolve:     resolveMovieEvent(eventMovieUpdated),
+	},
+	"movieDeleted": &graphql.Field{
+		Type:        movieType,
+		Description: "Notified when a movie is deleted",
+		Resolve:     resolveMovieEvent(eventMovieDeleted),
+	},
+}
+
+func resolveMovieEvent(eventType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		root, _ := p.Source.(map[string]interface{})
+		e, ok := root[subscriptionRootKey].(event)
+		if !ok || e.Type != eventType {
+			return nil, nil
+		}
+		return e.Movie, nil
+	}
+}
+
+// wsMessage graphql-transport-wsプロトコルのメッセージ
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn 1つのWebSocket接続の状態
+type wsConn struct {
+	app    *application
+	conn   *websocket.Conn
+	schema graphql.Schema
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+}
+
+// graphQLWebSocket graphql-transport-wsプロトコルでサブスクリプションを提供する
+func (app *application) graphQLWebSocket(w http.ResponseWriter, r *http.Request) {
+	schema, err := app.graphQLSchema()
+	if err != nil {
+		app.logger.Println(err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgradeがエラーレスポンスを書き込み済み
+		app.logger.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != "graphql-transport-ws" {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError, "unsupported subprotocol"))
+		return
+	}
+
+	c := &wsConn{
+		app:    app,
+		conn:   conn,
+		schema: schema,
+		subs:   make(map[string]context.CancelFunc),
+	}
+	defer c.cancelAll()
+
+	c.serve()
+}
+
+// serve 接続が閉じられるまでクライアントからのメッセージを処理する
+func (c *wsConn) serve() {
+	acknowledged := false
+	c.conn.SetReadDeadline(time.Now().Add(connectionInitTimeout))
+
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if !acknowledged {
+				if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+					c.close(closeInitTimeout, "Connection initialisation timeout")
+				}
+			}
+			return
+		}
+
+		switch msg.Type {
+		case gqlConnectionInit:
+			if acknowledged {
+				c.close(closeTooManyInitRequest, "Too many initialisation requests")
+				return
+			}
+			acknowledged = true
+			c.conn.SetReadDeadline(time.Time{})
+			c.write(wsMessage{Type: gqlConnectionAck})
+
+		case gqlPing:
+			c.write(wsMessage{Type: gqlPong})
+
+		case gqlPong:
+
+		case gqlSubscribe:
+			if !acknowledged {
+				c.close(closeUnauthorized, "Unauthorized")
+				return
+			}
+			if msg.ID == "" {
+				c.close(closeInvalidMessage, "Subscribe message requires an id")
+				return
+			}
+			if !c.subscribe(msg) {
+				return
+			}
+
+		case gqlComplete:
+			c.cancel(msg.ID)
+
+		default:
+			c.close(closeInvalidMessage, "Invalid message type")
+			return
+		}
+	}
+}
+
+// subscribe subscribeメッセージの購読を開始する。接続を閉じた場合はfalseを返す
+func (c *wsConn) subscribe(msg wsMessage) bool {
+	var req graphQLRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		c.close(closeInvalidMessage, "Invalid subscribe payload")
+		return false
+	}
+
+	query, err := c.app.persistedQueries.resolve(req.Query, req.Extensions.PersistedQuery)
+	if err != nil {
+		c.writeError(msg.ID, err.Error())
+		return true
+	}
+	if err := checkSubscription(query, req.OperationName); err != nil {
+		c.writeError(msg.ID, err.Error())
+		return true
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subs[msg.ID]; ok {
+		c.mu.Unlock()
+		c.close(closeSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.subs[msg.ID] = cancel
+	c.mu.Unlock()
+
+	events, unsubscribe := c.app.events.subscribe()
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if !c.execute(ctx, msg.ID, req, query, e) {
+					c.cancel(msg.ID)
+					return
+				}
+			}
+		}
+	}()
+
+	return true
+}
+
+// checkSubscription 実行する操作がsubscriptionかを確かめる
+// queryとmutationはイベントごとに実行するものではないため、購読として受け付けない
+func checkSubscription(query, operationName string) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return err
+	}
+
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		d, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" {
+			if op != nil {
+				return errors.New("operationName is required when the document contains multiple operations")
+			}
+			op = d
+		} else if d.Name != nil && d.Name.Value == operationName {
+			op = d
+		}
+	}
+	if op == nil {
+		if operationName != "" {
+			return errors.New(`unknown operation named "` + operationName + `"`)
+		}
+		return errors.New("the document contains no operation")
+	}
+	if op.Operation != ast.OperationTypeSubscription {
+		return errors.New("only subscription operations can be subscribed to, got " + op.Operation)
+	}
+
+	return nil
+}
+
+// execute イベントをルート値としてクエリを実行し、結果を送信する
+// 実行エラーの場合はerrorを送信してfalseを返す
+func (c *wsConn) execute(ctx context.Context, id string, req graphQLRequest, query string, e event) bool {
+	resp := graphql.Do(graphql.Params{
+		Schema:         c.schema,
+		RequestString:  query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		RootObject:     map[string]interface{}{subscriptionRootKey: e},
+		Context:        ctx,
+	})
+	if len(resp.Errors) > 0 {
+		js, _ := json.Marshal(resp.Errors)
+		c.write(wsMessage{ID: id, Type: gqlError, Payload: js})
+		return false
+	}
+
+	// 購読しているイベントと種別が異なる場合は何も送らない
+	data, _ := resp.Data.(map[string]interface{})
+	matched := false
+	for _, v := range data {
+		if v != nil {
+			matched = true
+		}
+	}
+	if !matched {
+		return true
+	}
+
+	js, _ := json.Marshal(resp)
+	c.write(wsMessage{ID: id, Type: gqlNext, Payload: js})
+	return true
+}
+
+// cancel 購読を停止する
+func (c *wsConn) cancel(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, ok := c.subs[id]; ok {
+		cancel()
+		delete(c.subs, id)
+	}
+}
+
+func (c *wsConn) cancelAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, cancel := range c.subs {
+		cancel()
+		delete(c.subs, id)
+	}
+}
+
+func (c *wsConn) write(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.app.logger.Println(err)
+	}
+}
+
+func (c *wsConn) writeError(id, message string) {
+	type jsonError struct {
+		Message string `json:"message"`
+	}
+	js, _ := json.Marshal([]jsonError{{Message: message}})
+	c.write(wsMessage{ID: id, Type: gqlError, Payload: js})
+}
+
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
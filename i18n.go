@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contextKeyLocales GraphQLのリゾルバーに渡すAccept-Languageの優先順
+const contextKeyLocales contextKey = "locales"
+
+// localePattern 受け付ける言語タグ（小文字にしたBCP 47の言語と任意のサブタグ）
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// TranslationPayload 翻訳の作成・更新のリクエストボディ
+type TranslationPayload struct {
+	Locale      string `json:"locale"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     int    `json:"version"`
+}
+
+// normalizeLocale 言語タグを小文字・ハイフン区切りにする。不正な場合は空文字を返す
+func normalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if !localePattern.MatchString(tag) {
+		return ""
+	}
+	return tag
+}
+
+// preferredLocales リクエストが希望する言語を優先順に返す
+// クエリパラメータlangがあればそれだけを、無ければAccept-Languageをq値の高い順に返す
+func preferredLocales(r *http.Request) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if l := normalizeLocale(lang); l != "" {
+			return []string{l}
+		}
+		return nil
+	}
+	return parseAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// parseAcceptLanguage Accept-Languageヘッダーの言語をq値の高い順に返す
+// q=0の言語と"*"は含めない
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var prefs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	locales := make([]string, len(prefs))
+	for i, p := range prefs {
+		locales[i] = p.locale
+	}
+	return locales
+}
+
+// matchTranslation 希望する言語に最も合う翻訳を返す。無い場合はnilを返す
+// 各言語について完全一致、言語部分（"ja-jp"なら"ja"）の一致の順に探す
+func matchTranslation(translations map[string]*models.MovieTranslation, locales []string) *models.MovieTranslation {
+	for _, locale := range locales {
+		if t, ok := translations[locale]; ok {
+			return t
+		}
+		if i := strings.Index(locale, "-"); i > 0 {
+			if t, ok := translations[locale[:i]]; ok {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// localizeMovie 希望する言語の翻訳がある場合、タイトル・あらすじを置き換えた複製を返す
+// 翻訳が無い場合は元の言語のままmovieを返す
+func localizeMovie(movie *models.Movie, locales []string) *models.Movie {
+	t := matchTranslation(movie.Translations, locales)
+	if t == nil {
+		return movie
+	}
+
+	m := *movie
+	m.OriginalTitle = movie.Title
+	m.Title = t.Title
+	if t.Description != "" {
+		m.Description = t.Description
+	}
+	m.Locale = t.Locale
+	return &m
+}
+
+// localizeMovies moviesにlocalizeMovieを適用したスライスを返す
+func localizeMovies(movies []*models.Movie, locales []string) []*models.Movie {
+	if len(locales) == 0 {
+		return movies
+	}
+	localized := make([]*models.Movie, len(movies))
+	for i, movie := range movies {
+		localized[i] = localizeMovie(movie, locales)
+	}
+	return localized
+}
+
+// localeETag 希望する言語によって内容が変わるレスポンスのETagに、その言語を加える
+func localeETag(w http.ResponseWriter, etag string, locales []string) string {
+	w.Header().Add("Vary", "Accept-Language")
+	if len(locales) == 0 {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-l" + strings.Join(locales, ".") + `"`
+}
+
+// localesFromGraphQL GraphQLの引数langがあればそれを、無ければリクエストのAccept-Languageを返す
+func localesFromGraphQL(ctx context.Context, args map[string]interface{}) []string {
+	if lang, ok := args["lang"].(string); ok && lang != "" {
+		if l := normalizeLocale(lang); l != "" {
+			return []string{l}
+		}
+		return nil
+	}
+	locales, _ := ctx.Value(contextKeyLocales).([]string)
+	return locales
+}
+
+// getMovieTranslations 映画の翻訳を言語タグ順に返す
+func (app *application) getMovieTranslations(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	movie, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	translations := make([]*models.MovieTranslation, 0, len(movie.Translations))
+	for _, t := range movie.Translations {
+		translations = append(translations, t)
+	}
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Locale < translations[j].Locale })
+
+	err = app.writeJSON(w, http.StatusOK, translations, "translations")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editMovieTranslation 映画の翻訳を作成・更新する
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieTranslation(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload TranslationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	t := models.MovieTranslation{
+		MovieID:     id,
+		Locale:      normalizeLocale(payload.Locale),
+		Title:       strings.TrimSpace(payload.Title),
+		Description: payload.Description,
+		UpdatedAt:   time.Now(),
+	}
+	if t.Locale == "" {
+		app.errorJSON(w, errors.New("locale must be a language tag such as ja or en-us"))
+		return
+	}
+	if t.Title == "" {
+		app.errorJSON(w, errors.New("title is required"))
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SaveMovieTranslation(t, expectedVersion)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteMovieTranslation 映画の翻訳を削除する
+func (app *application) deleteMovieTranslation(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+	locale := normalizeLocale(params.ByName("locale"))
+
+	version, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.DeleteMovieTranslation(id, locale, version)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("translation not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxImagePixels デコードを許可する画像の画素数の上限（展開後のメモリ消費を抑えるため）
+const maxImagePixels = 40 * 1000 * 1000
+
+// thumbnailJPEGQuality サムネイルのJPEG品質
+const thumbnailJPEGQuality = 85
+
+// imageExtensions アップロードを受け付ける画像の形式と保存時の拡張子
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// thumbnailBounds 画像の種類ごとのサムネイルの最大サイズ
+var thumbnailBounds = map[string]image.Point{
+	models.ImagePoster:   {X: 300, Y: 450},
+	models.ImageBackdrop: {X: 533, Y: 300},
+}
+
+// uploadMovieImage 映画にポスター・背景画像をアップロードする
+// multipart/form-dataのimageにファイルを、kindにposter（デフォルト）またはbackdropを指定する
+func (app *application) uploadMovieImage(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	// multipartの境界やヘッダーの分として1MBの余裕を持たせる
+	maxSize := app.config.images.maxSize
+	if r.ContentLength > maxSize+1<<20 {
+		app.errorJSON(w, errImageTooLarge(maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = models.ImagePoster
+	}
+	bounds, ok := thumbnailBounds[kind]
+	if !ok {
+		app.errorJSON(w, errors.New("kind must be poster or backdrop"))
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		app.errorJSON(w, errors.New("image file is required"))
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		app.errorJSON(w, errImageTooLarge(maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// クライアントが申告したContent-Typeは信用せず、内容から判定する
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		app.errorJSON(w, fmt.Errorf("unsupported image type %s: use JPEG, PNG or GIF", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		app.errorJSON(w, fmt.Errorf("image must not exceed %d pixels", maxImagePixels), http.StatusUnprocessableEntity)
+		return
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	var thumb bytes.Buffer
+	err = jpeg.Encode(&thumb, thumbnail(src, bounds), &jpeg.Options{Quality: thumbnailJPEGQuality})
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	name, err := randomName()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	img := models.MovieImage{
+		MovieID:      id,
+		Kind:         kind,
+		Key:          fmt.Sprintf("movies/%d/%s-%s.%s", id, kind, name, ext),
+		ThumbnailKey: fmt.Sprintf("movies/%d/%s-%s-thumb.jpg", id, kind, name),
+		ContentType:  contentType,
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		Size:         int64(len(data)),
+		CreatedAt:    time.Now(),
+	}
+	img.URL = app.storage.URL(img.Key)
+	img.ThumbnailURL = app.storage.URL(img.ThumbnailKey)
+
+	if err := app.storage.Put(r.Context(), img.Key, bytes.NewReader(data), contentType); err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if err := app.storage.Put(r.Context(), img.ThumbnailKey, &thumb, "image/jpeg"); err != nil {
+		app.deleteStoredFiles(img.Key)
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		var err error
+		img.ID, err = db.InsertMovieImage(img, version)
+		return err
+	})
+	if err != nil {
+		app.deleteStoredFiles(img.Key, img.ThumbnailKey)
+		if err == models.ErrEditConflict {
+			app.errorJSON(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, img, "image")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteMovieImage 映画から画像を外し、ストレージからも削除する
+func (app *application) deleteMovieImage(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+	imageID, err := strconv.Atoi(params.ByName("image_id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid image_id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	img, err := app.models.DB.GetMovieImage(id, imageID)
+	if err == nil {
+		err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+			return db.DeleteMovieImage(*img, version)
+		})
+	}
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("image not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.deleteStoredFiles(img.Key, img.ThumbnailKey)
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// serveStoredFile ローカルに保存した画像を配信する
+// ストレージが配信に対応していない場合（外部のURLで配信する場合）は404を返す
+func (app *application) serveStoredFile(w http.ResponseWriter, r *http.Request) {
+	h, ok := app.storage.(http.Handler)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// deleteStoredFiles ストレージからファイルを削除する
+// 削除に失敗しても操作自体の結果は変わらないため、エラーはログに出力するだけにする
+func (app *application) deleteStoredFiles(keys ...string) {
+	for _, key := range keys {
+		if err := app.storage.Delete(context.Background(), key); err != nil {
+			app.logger.Println("storage:", err)
+		}
+	}
+}
+
+func errImageTooLarge(maxSize int64) error {
+	return fmt.Errorf("image must not be larger than %d bytes", maxSize)
+}
+
+// randomName 保存するファイル名に使う推測できない文字列を返す
+func randomName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// thumbnail srcを縦横比を保ったままbounds以内に縮小する（拡大はしない）
+// 透過部分はJPEGで保存できるよう白で塗りつぶし、縮小は範囲内の画素の平均で行う
+func thumbnail(src image.Image, bounds image.Point) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	dw, dh := sw, sh
+	if dw > bounds.X {
+		dw, dh = bounds.X, sh*bounds.X/sw
+	}
+	if dh > bounds.Y {
+		dw, dh = sw*bounds.Y/sh, bounds.Y
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, sb.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				i := flat.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(flat.Pix[i])
+					g += int(flat.Pix[i+1])
+					b += int(flat.Pix[i+2])
+					i += 4
+					n++
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = 0xff
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize 一括取り込みで受け付けるリクエストボディの上限
+const maxImportSize = 10 << 20
+
+// 一括取り込みの入力形式
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// validMPAARatings 受け付けるMPAAレーティング（空は未設定）
+var validMPAARatings = map[string]bool{"": true, "G": true, "PG": true, "PG13": true, "R": true, "NC17": true}
+
+// ImportPayload 一括取り込みの1件。MoviePayloadの項目にジャンル名を加えたもの
+type ImportPayload struct {
+	MoviePayload
+	Genres []string `json:"genres"`
+}
+
+// importRecord 入力から読み取った1件と、読み取り時のエラー
+// fieldsは入力に含まれていた項目（CSVの列名・JSONのキー）
+type importRecord struct {
+	row     int
+	payload ImportPayload
+	fields  map[string]bool
+	errors  []importRowError
+}
+
+// importRowError 取り込めなかった行とその理由
+type importRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// importRowResult 取り込んだ行と作成・更新された映画
+type importRowResult struct {
+	Row    int    `json:"row"`
+	ID     int    `json:"id"`
+	Action string `json:"action"`
+}
+
+// importSummary 一括取り込みの結果
+type importSummary struct {
+	DryRun    bool              `json:"dry_run"`
+	Atomic    bool              `json:"atomic"`
+	Committed bool              `json:"committed"`
+	Total     int               `json:"total"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Failed    int               `json:"failed"`
+	Results   []importRowResult `json:"results"`
+	Errors    []importRowError  `json:"errors"`
+}
+
+// importFormat クエリパラメータ、Content-Type、ファイル名の順に入力形式を判定する
+func importFormat(format, contentType, filename string) (string, error) {
+	if format == "" && contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "text/csv":
+			format = formatCSV
+		case "application/json":
+			format = formatJSON
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			format = formatNDJSON
+		}
+	}
+	if format == "" && filename != "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+		if format == "jsonl" {
+			format = formatNDJSON
+		}
+	}
+
+	switch format {
+	case formatCSV, formatJSON, formatNDJSON:
+		return format, nil
+	}
+	return "", errors.New("unsupported import format: use csv, json or ndjson")
+}
+
+// parseImport 入力を形式に応じて読み取る
+// 行ごとの値の誤りはimportRecord.errorsに入れ、入力全体を読めない場合のみerrorを返す
+func parseImport(r io.Reader, format string) ([]importRecord, error) {
+	switch format {
+	case formatCSV:
+		return parseImportCSV(r)
+	case formatJSON:
+		return parseImportJSON(r)
+	case formatNDJSON:
+		return parseImportNDJSON(r)
+	}
+	return nil, errors.New("unsupported import format")
+}
+
+// parseImportCSV 1行目をヘッダーとしてCSVを読み取る
+// 列名はMoviePayloadのJSONのキーと同じで、genresは"|"区切りのジャンル名
+func parseImportCSV(r io.Reader) ([]importRecord, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool)
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch header[i] {
+		case "id", "title", "description", "release_date", "runtime", "rating", "mpaa_rating", "version", "genres":
+			fields[header[i]] = true
+		default:
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	var records []importRecord
+	for row := 2; ; row++ {
+		values, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec := importRecord{row: row, fields: fields}
+		p := &rec.payload
+		for i, v := range values {
+			v = strings.TrimSpace(v)
+			switch header[i] {
+			case "title":
+				p.Title = v
+			case "description":
+				p.Description = v
+			case "release_date":
+				p.ReleaseDate = v
+			case "mpaa_rating":
+				p.MPAARating = v
+			case "id", "version", "runtime", "rating":
+				if v == "" {
+					continue
+				}
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					rec.errors = append(rec.errors, importRowError{Row: row, Field: header[i], Message: "must be an integer"})
+					continue
+				}
+				switch header[i] {
+				case "id":
+					p.ID = n
+				case "version":
+					p.Version = n
+				case "runtime":
+					p.Runtime = n
+				case "rating":
+					p.Rating = n
+				}
+			case "genres":
+				p.Genres = []string{}
+				for _, g := range strings.Split(v, "|") {
+					if g = strings.TrimSpace(g); g != "" {
+						p.Genres = append(p.Genres, g)
+					}
+				}
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// parseImportJSON 映画の配列を読み取る
+func parseImportJSON(r io.Reader) ([]importRecord, error) {
+	var raws []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raws); err != nil {
+		return nil, err
+	}
+
+	records := make([]importRecord, 0, len(raws))
+	for i, raw := range raws {
+		records = append(records, decodeImportRecord(i+1, raw))
+	}
+
+	return records, nil
+}
+
+// parseImportNDJSON 1行に1件の映画を読み取る
+func parseImportNDJSON(r io.Reader) ([]importRecord, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxImportSize)
+
+	var records []importRecord
+	for row := 1; sc.Scan(); row++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		records = append(records, decodeImportRecord(row, line))
+	}
+
+	return records, sc.Err()
+}
+
+func decodeImportRecord(row int, raw []byte) importRecord {
+	rec := importRecord{row: row}
+	if err := json.Unmarshal(raw, &rec.payload); err != nil {
+		rec.errors = append(rec.errors, importRowError{Row: row, Message: err.Error()})
+		return rec
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err == nil {
+		rec.fields = make(map[string]bool, len(keys))
+		for k := range keys {
+			rec.fields[strings.ToLower(k)] = true
+		}
+	}
+	return rec
+}
+
+// validateImport 1件を検証し、取り込み用のImportMovieに変換する
+// genreIDsはジャンル名（小文字）からIDへの対応
+func validateImport(rec importRecord, genreIDs map[string]int, now time.Time) (models.ImportMovie, []importRowError) {
+	errs := rec.errors
+	for _, e := range errs {
+		// 1件全体を読み取れなかった場合は項目ごとの検証をしない
+		if e.Field == "" {
+			return models.ImportMovie{}, errs
+		}
+	}
+	fail := func(field, message string) {
+		errs = append(errs, importRowError{Row: rec.row, Field: field, Message: message})
+	}
+
+	p := rec.payload
+	var item models.ImportMovie
+	movie := &item.Movie
+
+	movie.Title = strings.TrimSpace(p.Title)
+	if movie.Title == "" {
+		fail("title", "is required")
+	}
+
+	var err error
+	movie.ReleaseDate, err = time.Parse("2006-01-02", p.ReleaseDate)
+	if err != nil {
+		fail("release_date", "must be a date in YYYY-MM-DD format")
+	}
+	movie.Year = movie.ReleaseDate.Year()
+
+	if p.Runtime < 0 {
+		fail("runtime", "must not be negative")
+	}
+	if p.Rating < 0 || p.Rating > 5 {
+		fail("rating", "must be between 0 and 5")
+	}
+	if !validMPAARatings[p.MPAARating] {
+		fail("mpaa_rating", "must be one of G, PG, PG13, R, NC17")
+	}
+
+	if p.ID < 0 {
+		fail("id", "must not be negative")
+	}
+	if p.Version < 0 {
+		fail("version", "must not be negative")
+	}
+
+	movie.ID = p.ID
+	movie.Version = p.Version
+	movie.Description = p.Description
+	movie.Runtime = p.Runtime
+	movie.Rating = p.Rating
+	movie.MPAARating = p.MPAARating
+	movie.CreatedAt = now
+	movie.UpdatedAt = now
+	item.Fields = rec.fields
+
+	if p.Genres != nil {
+		// 同じジャンルが複数回指定されても紐付けは1つにする
+		item.GenreIDs = []int{}
+		seen := map[int]bool{}
+		for _, name := range p.Genres {
+			id, ok := genreIDs[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				fail("genres", fmt.Sprintf("unknown genre %q", name))
+				continue
+			}
+			if !seen[id] {
+				seen[id] = true
+				item.GenreIDs = append(item.GenreIDs, id)
+			}
+		}
+	}
+
+	return item, errs
+}
+
+// importMovies 読み取った全件を検証して取り込む
+// 検証に失敗した行はデータベースに送らず、Atomicの場合は1件でも失敗すれば何も書き込まない
+// 書き込んだ映画は同じトランザクションで監査ログに記録してWebhookの配信をキューに追加し、コミットした後に購読者に通知する
+// 操作したユーザーはctxから取り出す（サブコマンドの場合は0）
+func (app *application) importMovies(ctx context.Context, records []importRecord, opts models.ImportOptions) (*importSummary, error) {
+	genres, err := app.models.DB.GetAllGenres()
+	if err != nil {
+		return nil, err
+	}
+	genreIDs := make(map[string]int)
+	for _, g := range genres {
+		genreIDs[strings.ToLower(g.GenreName)] = g.ID
+	}
+
+	summary := &importSummary{
+		DryRun:  opts.DryRun,
+		Atomic:  opts.Atomic,
+		Total:   len(records),
+		Results: []importRowResult{},
+		Errors:  []importRowError{},
+	}
+
+	now := time.Now()
+	var items []models.ImportMovie
+	var rows []int
+	for _, rec := range records {
+		item, errs := validateImport(rec, genreIDs, now)
+		if len(errs) > 0 {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, errs...)
+			continue
+		}
+		items = append(items, item)
+		rows = append(rows, rec.row)
+	}
+
+	if opts.Atomic && summary.Failed > 0 {
+		return summary, nil
+	}
+
+	var events []event
+	outcomes, err := app.models.DB.ImportMovies(items, opts, func(db *models.DBModel, o models.ImportOutcome) error {
+		e := event{Type: eventMovieUpdated, OccurredAt: now}
+		if o.Created {
+			e.Type = eventMovieCreated
+		}
+
+		var err error
+		if e.Movie, err = db.GetMovie(o.ID); err != nil {
+			return err
+		}
+		if err := app.audit(ctx, db, auditImport, auditEntityMovie, o.ID, o.Before, e.Movie); err != nil {
+			return err
+		}
+		if err := app.queueEvent(db, e); err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, o := range outcomes {
+		if o.Err != nil {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, importRowError{Row: rows[i], Message: o.Err.Error()})
+			continue
+		}
+
+		result := importRowResult{Row: rows[i], ID: o.ID, Action: auditUpdate}
+		if o.Created {
+			summary.Created++
+			result.Action = auditCreate
+		} else {
+			summary.Updated++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	// ドライランでは書き込まれた場合の件数を返し、全件ロールバックした場合は0件とする
+	summary.Committed = !opts.DryRun && !(opts.Atomic && summary.Failed > 0)
+	if !summary.Committed && !opts.DryRun {
+		summary.Created, summary.Updated = 0, 0
+	}
+
+	// コミットした場合だけ取り込んだ映画を購読者に通知する
+	if summary.Committed {
+		for _, e := range events {
+			app.events.publish(e)
+		}
+	}
+
+	return summary, nil
+}
+
+// importMoviesHandler CSV・JSON配列・NDJSONの映画を一括で取り込む
+// クエリパラメータ: format (csv|json|ndjson), dry_run, atomic
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format, err := importFormat(q.Get("format"), r.Header.Get("Content-Type"), "")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var opts models.ImportOptions
+	for name, dest := range map[string]*bool{"dry_run": &opts.DryRun, "atomic": &opts.Atomic} {
+		if v := q.Get(name); v != "" {
+			if *dest, err = strconv.ParseBool(v); err != nil {
+				app.errorJSON(w, fmt.Errorf("invalid %s parameter", name))
+				return
+			}
+		}
+	}
+
+	records, err := parseImport(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	summary, err := app.importMovies(r.Context(), records, opts)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if opts.Atomic && summary.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeJSON(w, status, summary, "import")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestImportCSVKeepsIDAndVersion 書き出したCSVのidとversionを読み取り、取り込む映画に渡すこと
+func TestImportCSVKeepsIDAndVersion(t *testing.T) {
+	input := "id,version,title,release_date\n7,3,Heat,1995-12-15\n"
+	records, err := parseImportCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+
+	item, errs := validateImport(records[0], nil, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if item.Movie.ID != 7 || item.Movie.Version != 3 {
+		t.Errorf("id, version = %d, %d, want 7, 3", item.Movie.ID, item.Movie.Version)
+	}
+	// 入力に無い列は既存の映画の値を残す
+	if item.Fields["description"] || !item.Fields["title"] {
+		t.Errorf("fields = %v, want only the CSV columns", item.Fields)
+	}
+}
@@ -16,6 +16,9 @@ import (
 // version ... application version
 const version = "1.0"
 
+// defaultDSN 接続先のデフォルト
+const defaultDSN = "postgres://postgres@localhost/manage_movies?sslmode=disable"
+
 // config ... application configuration
 type config struct {
 	port int
@@ -24,32 +27,91 @@ type config struct {
 		// data source name (ex. database_name, user_name etc...)
 		dsn string
 	}
+	cache struct {
+		// キャッシュする件数の上限。0の場合はキャッシュしない
+		size int
+		ttl  time.Duration
+	}
 	jwt struct {
 		secret string
 	}
+	trash struct {
+		// ゴミ箱の映画を完全に削除するまでの期間。0の場合は自動で削除しない
+		retention time.Duration
+	}
+	http struct {
+		// 一覧・詳細のGETレスポンスに付与するCache-Controlヘッダー
+		cacheControl string
+	}
+	graphql struct {
+		// Persisted Queryのマニフェストファイルのパス
+		manifest  string
+		allowList bool
+	}
+	storage struct {
+		// アップロードされた画像を保存するディレクトリと、配信するURLの接頭辞
+		dir     string
+		baseURL string
+	}
+	images struct {
+		// アップロードできる画像の最大バイト数
+		maxSize int64
+	}
+	metadata struct {
+		// メタデータの取り込みに使うフィクスチャのディレクトリ。空の場合は取り込みを無効にする
+		fixtures string
+	}
+	webhooks struct {
+		// 配信キューを確認して送信する間隔。0の場合はこのプロセスでは送信しない
+		interval time.Duration
+	}
 }
 
 // application ... application log & configuration
 type application struct {
-	config config
-	logger *log.Logger
-	models models.Models
+	config           config
+	logger           *log.Logger
+	models           models.Models
+	persistedQueries *persistedQueryStore
+	events           *eventBus
+	storage          Storage
+	metadata         MetadataProvider
+	openAPI          []byte
 }
 
 // AppStatus ... application status struct
 type AppStatus struct {
-	Status      string `json:"status"`
-	Environment string `json:"environment"`
-	Version     string `json:"version"`
+	Status      string            `json:"status"`
+	Environment string            `json:"environment"`
+	Version     string            `json:"version"`
+	Cache       models.CacheStats `json:"cache"`
 }
 
 func main() {
+	// サブコマンドが指定された場合はサーバーを起動せずに実行する
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
 	var cfg config
 	// 設定用のconfigのフィールドをコマンドライン引数から受け取る
 	flag.IntVar(&cfg.port, "port", 4000, "Server port to listen on")
 	flag.StringVar(&cfg.env, "env", "development", "Application environment (development|production)")
-	flag.StringVar(&cfg.db.dsn, "dsn", "postgres://postgres@localhost/manage_movies?sslmode=disable", "Postgres connection starting")
+	flag.StringVar(&cfg.db.dsn, "dsn", defaultDSN, "Postgres connection starting")
+	flag.IntVar(&cfg.cache.size, "cache-size", 1000, "Maximum number of cached query results (0 disables the cache)")
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", 5*time.Minute, "Lifetime of cached query results")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash (0 keeps them forever)")
 	flag.StringVar(&cfg.jwt.secret, "jwt-secret", "2dce505d96a53c5768052ee90f3df2055657518dad489160df9913f66042e160", "secret")
+	flag.StringVar(&cfg.http.cacheControl, "cache-control", "public, max-age=60", "Cache-Control header for cacheable read endpoints (empty to omit)")
+	flag.StringVar(&cfg.graphql.manifest, "graphql-manifest", "", "Persisted query manifest file for /v1/graphql")
+	flag.BoolVar(&cfg.graphql.allowList, "graphql-allowlist", false, "Only execute operations registered in the persisted query manifest")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "uploads", "Directory to store uploaded images in")
+	flag.StringVar(&cfg.storage.baseURL, "storage-base-url", "/v1/images", "URL prefix the stored images are served from")
+	flag.Int64Var(&cfg.images.maxSize, "max-image-size", 10<<20, "Maximum size of an uploaded image in bytes")
+	flag.StringVar(&cfg.metadata.fixtures, "metadata-fixtures", "", "Directory of JSON fixtures to import movie metadata from (empty disables the import)")
+	flag.DurationVar(&cfg.webhooks.interval, "webhook-interval", 5*time.Second, "How often to send queued webhook deliveries (0 disables sending from this process)")
 	flag.Parse()
 
 	// コマンドライン出力用ログを作成する
@@ -62,10 +124,65 @@ func main() {
 	}
 	defer db.Close()
 
+	// DBの読み込み結果のキャッシュを作成
+	var cache models.Cache
+	if cfg.cache.size > 0 {
+		cache = models.NewLRUCache(cfg.cache.size, cfg.cache.ttl)
+	}
+
+	// Persisted Queryのストアを作成し、マニフェストがあれば読み込む
+	persistedQueries := newPersistedQueryStore(cfg.graphql.allowList)
+	if cfg.graphql.manifest != "" {
+		n, err := persistedQueries.loadManifest(cfg.graphql.manifest)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		logger.Println("Loaded", n, "persisted queries from", cfg.graphql.manifest)
+	} else if cfg.graphql.allowList {
+		log.Fatalln("-graphql-allowlist requires -graphql-manifest")
+	}
+
+	// アップロードされた画像の保存先を作成
+	storage, err := newLocalStorage(cfg.storage.dir, cfg.storage.baseURL)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// メタデータの提供元を作成
+	var metadata MetadataProvider
+	if cfg.metadata.fixtures != "" {
+		fixtures, err := newFixtureProvider(cfg.metadata.fixtures)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		logger.Println("Loaded metadata for", len(fixtures.records), "external ids from", cfg.metadata.fixtures)
+		metadata = fixtures
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: models.NewModels(db),
+		config:           cfg,
+		logger:           logger,
+		models:           models.NewModels(db, cache),
+		persistedQueries: persistedQueries,
+		events:           newEventBus(),
+		storage:          storage,
+		metadata:         metadata,
+	}
+
+	// ルーティングテーブルからOpenAPIドキュメントを生成する
+	app.openAPI, err = app.buildOpenAPI()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// ゴミ箱の保持期間を過ぎた映画を1時間ごとに完全削除する
+	if cfg.trash.retention > 0 {
+		go app.purgeTrashPeriodically(cfg.trash.retention, time.Hour)
+	}
+
+	// Webhookの配信キューから送信時刻を過ぎた配信を送信する
+	if cfg.webhooks.interval > 0 {
+		go app.deliverWebhooksPeriodically(cfg.webhooks.interval)
 	}
 
 	// APIサーバーを作成
@@ -75,6 +192,8 @@ func main() {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		// 書き出しのように長く書き込むハンドラーが書き込みの期限を延ばせるよう、接続をcontextに格納する
+		ConnContext: saveConn,
 	}
 
 	logger.Println("Starting server on port", cfg.port)
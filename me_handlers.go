@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 視聴履歴の1ページの件数
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// WatchlistPayload ウォッチリストに追加するリクエストボディ
+type WatchlistPayload struct {
+	MovieID int    `json:"movie_id"`
+	Note    string `json:"note"`
+}
+
+// WatchlistOrderPayload ウォッチリストの並び替えのリクエストボディ
+type WatchlistOrderPayload struct {
+	MovieIDs []int `json:"movie_ids"`
+}
+
+// WatchEventPayload 視聴履歴に追加するリクエストボディ
+// watched_atはRFC 3339形式で、省略した場合は現在日時とする
+type WatchEventPayload struct {
+	MovieID   int    `json:"movie_id"`
+	WatchedAt string `json:"watched_at"`
+	Note      string `json:"note"`
+}
+
+// watchHistory 視聴履歴のレスポンス
+type watchHistory struct {
+	History  []*models.WatchEvent `json:"history"`
+	Metadata pageMetadata         `json:"metadata"`
+}
+
+// getWatchlist ログインしているユーザーのウォッチリストを返す
+// クエリパラメータ: order (position|added_at|title、デフォルトはposition)
+func (app *application) getWatchlist(w http.ResponseWriter, r *http.Request) {
+	order := models.WatchlistOrder(r.URL.Query().Get("order"))
+	switch order {
+	case "":
+		order = models.WatchlistOrderPosition
+	case models.WatchlistOrderPosition, models.WatchlistOrderAddedAt, models.WatchlistOrderTitle:
+	default:
+		app.errorJSON(w, errors.New("order must be one of position, added_at, title"))
+		return
+	}
+
+	items, err := app.models.DB.GetWatchlist(userIDFromContext(r.Context()), order)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, items, "watchlist")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// addToWatchlist 映画をウォッチリストの末尾に追加する。既にある場合はメモを更新する
+func (app *application) addToWatchlist(w http.ResponseWriter, r *http.Request) {
+	var payload WatchlistPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if _, err := app.models.DB.GetMovie(payload.MovieID); err != nil {
+		app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+
+	added, err := app.models.DB.SaveWatchlistItem(userIDFromContext(r.Context()), payload.MovieID, payload.Note, time.Now())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// removeFromWatchlist 映画をウォッチリストから外す
+func (app *application) removeFromWatchlist(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.RemoveWatchlistItem(userIDFromContext(r.Context()), movieID)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("movie is not in the watchlist"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// reorderWatchlist ウォッチリストを指定した映画IDの順に並べ替える
+func (app *application) reorderWatchlist(w http.ResponseWriter, r *http.Request) {
+	var payload WatchlistOrderPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err := app.models.DB.ReorderWatchlist(userIDFromContext(r.Context()), payload.MovieIDs)
+	if err == models.ErrInvalidWatchlistOrder {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getWatchHistory ログインしているユーザーの視聴履歴を新しい順に返す
+// クエリパラメータ: limit (デフォルト50、最大200), offset
+func (app *application) getWatchHistory(w http.ResponseWriter, r *http.Request) {
+	var res watchHistory
+	var err error
+	res.Metadata, err = parsePage(r.URL.Query(), defaultHistoryLimit, maxHistoryLimit)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	res.History, res.Metadata.Total, err = app.models.DB.GetWatchHistory(userIDFromContext(r.Context()), res.Metadata.Limit, res.Metadata.Offset)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, res, "")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// addWatchEvent 映画を視聴済みとして履歴に追加する
+func (app *application) addWatchEvent(w http.ResponseWriter, r *http.Request) {
+	var payload WatchEventPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	e := models.WatchEvent{MovieID: payload.MovieID, Note: payload.Note, WatchedAt: time.Now()}
+	if payload.WatchedAt != "" {
+		t, err := time.Parse(time.RFC3339, payload.WatchedAt)
+		if err != nil {
+			app.errorJSON(w, errors.New("watched_at must be an RFC 3339 timestamp"))
+			return
+		}
+		if t.After(time.Now()) {
+			app.errorJSON(w, errors.New("watched_at must not be in the future"))
+			return
+		}
+		e.WatchedAt = t
+	}
+
+	movie, err := app.models.DB.GetMovie(payload.MovieID)
+	if err != nil {
+		app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+
+	e.ID, err = app.models.DB.InsertWatchEvent(userIDFromContext(r.Context()), e)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	e.Movie = movie
+
+	err = app.writeJSON(w, http.StatusCreated, e, "history")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteWatchEvent 視聴履歴を1件削除する
+func (app *application) deleteWatchEvent(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.DeleteWatchEvent(userIDFromContext(r.Context()), id)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("history entry not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// personalValidator ログインしている場合、条件付きGETに使うetagとlastModifiedに
+// ユーザーとそのウォッチリストの状態を加える
+func (app *application) personalValidator(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) (string, time.Time, error) {
+	w.Header().Add("Vary", "Authorization")
+
+	userID := userIDFromContext(r.Context())
+	if userID == 0 {
+		return etag, lastModified, nil
+	}
+
+	v, err := app.models.DB.WatchlistValidator(userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	etag = strings.TrimSuffix(etag, `"`) + fmt.Sprintf(`-u%d.%d.%d"`, userID, v.Count, v.LastModified.UnixNano())
+	if v.LastModified.After(lastModified) {
+		lastModified = v.LastModified
+	}
+
+	return etag, lastModified, nil
+}
+
+// withWatchlistFlags ログインしている場合、moviesの複製にウォッチリストにあるかを設定して返す
+func (app *application) withWatchlistFlags(r *http.Request, movies []*models.Movie) ([]*models.Movie, error) {
+	userID := userIDFromContext(r.Context())
+	if userID == 0 {
+		return movies, nil
+	}
+
+	ids, err := app.models.DB.WatchlistMovieIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	flagged := make([]*models.Movie, len(movies))
+	for i, movie := range movies {
+		m := *movie
+		inWatchlist := ids[m.ID]
+		m.InWatchlist = &inWatchlist
+		flagged[i] = &m
+	}
+
+	return flagged, nil
+}
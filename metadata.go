@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// errMetadataNotFound 提供元に外部IDに一致する映画が無い
+var errMetadataNotFound = errors.New("metadata not found")
+
+// externalSources 外部IDの提供元。メタデータはこの順に探す
+var externalSources = []string{models.ExternalSourceIMDb, models.ExternalSourceTMDb}
+
+// externalIDPatterns 提供元ごとの外部IDの形式
+var externalIDPatterns = map[string]*regexp.Regexp{
+	models.ExternalSourceIMDb: regexp.MustCompile(`^tt[0-9]{7,10}$`),
+	models.ExternalSourceTMDb: regexp.MustCompile(`^[0-9]{1,10}$`),
+}
+
+// metadataFields 取り込みの対象にする項目（MoviePayloadのJSONの項目名）
+var metadataFields = []string{"title", "description", "release_date", "runtime", "rating", "mpaa_rating"}
+
+// MovieMetadata 提供元から取得した映画のメタデータ
+// Movieのゼロ値の項目は提供元に情報が無いものとして扱い、IDとVersionは使わない
+type MovieMetadata struct {
+	Movie       MoviePayload
+	ExternalIDs map[string]string
+}
+
+// MetadataProvider 映画のメタデータの提供元
+type MetadataProvider interface {
+	// Name 取り込んだ項目の記録に使う提供元の名前
+	Name() string
+	// Lookup 外部IDに一致する映画のメタデータを返す。見つからない場合はerrMetadataNotFoundを返す
+	Lookup(ctx context.Context, source, externalID string) (*MovieMetadata, error)
+}
+
+// ExternalIDsPayload 映画の外部IDを置き換えるリクエストボディ
+type ExternalIDsPayload struct {
+	Version     int               `json:"version"`
+	ExternalIDs map[string]string `json:"external_ids"`
+}
+
+// metadataReport メタデータの取り込み結果
+// Appliedは書き込んだ項目とその値、Skippedは書き込まなかった項目とその理由
+type metadataReport struct {
+	Provider    string            `json:"provider"`
+	Source      string            `json:"source"`
+	ExternalID  string            `json:"external_id"`
+	DryRun      bool              `json:"dry_run"`
+	Applied     map[string]string `json:"applied"`
+	Skipped     map[string]string `json:"skipped"`
+	ExternalIDs map[string]string `json:"added_external_ids"`
+}
+
+// fixtureProvider ディレクトリ内のJSONファイルをメタデータとして返す提供元
+// 外部のサービスに接続せずに取り込みを試せるようにするためのもの
+type fixtureProvider struct {
+	records map[string]*MovieMetadata
+}
+
+// metadataFixture フィクスチャファイルの形式（MoviePayloadの項目と外部ID）
+type metadataFixture struct {
+	MoviePayload
+	ExternalIDs map[string]string `json:"external_ids"`
+}
+
+// newFixtureProvider dirにある*.jsonファイルを読み込み、外部IDで引けるようにする
+func newFixtureProvider(dir string) (*fixtureProvider, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &fixtureProvider{records: make(map[string]*MovieMetadata)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var f metadataFixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := validateExternalIDs(f.ExternalIDs); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if len(f.ExternalIDs) == 0 {
+			return nil, fmt.Errorf("%s: external_ids is required", file)
+		}
+
+		md := &MovieMetadata{Movie: f.MoviePayload, ExternalIDs: f.ExternalIDs}
+		for source, externalID := range f.ExternalIDs {
+			p.records[source+":"+externalID] = md
+		}
+	}
+
+	return p, nil
+}
+
+func (p *fixtureProvider) Name() string {
+	return "fixture"
+}
+
+func (p *fixtureProvider) Lookup(ctx context.Context, source, externalID string) (*MovieMetadata, error) {
+	md, ok := p.records[source+":"+externalID]
+	if !ok {
+		return nil, errMetadataNotFound
+	}
+	return md, nil
+}
+
+// validateExternalIDs 外部IDの提供元と形式を検証する
+func validateExternalIDs(ids map[string]string) error {
+	for source, externalID := range ids {
+		pattern, ok := externalIDPatterns[source]
+		if !ok {
+			return fmt.Errorf("unknown external id source %q: use imdb or tmdb", source)
+		}
+		if !pattern.MatchString(externalID) {
+			return fmt.Errorf("invalid %s id %q", source, externalID)
+		}
+	}
+	return nil
+}
+
+// payloadFromMovie 映画をMoviePayloadの形にする
+func payloadFromMovie(movie *models.Movie) MoviePayload {
+	p := MoviePayload{
+		ID:          movie.ID,
+		Title:       movie.Title,
+		Description: movie.Description,
+		Runtime:     movie.Runtime,
+		Rating:      movie.Rating,
+		MPAARating:  movie.MPAARating,
+		Version:     movie.Version,
+	}
+	if !movie.ReleaseDate.IsZero() {
+		p.ReleaseDate = movie.ReleaseDate.Format("2006-01-02")
+	}
+	return p
+}
+
+// payloadField MoviePayloadの項目の値を文字列で返す。ゼロ値は空文字にする
+func payloadField(p MoviePayload, field string) string {
+	n := 0
+	switch field {
+	case "title":
+		return p.Title
+	case "description":
+		return p.Description
+	case "release_date":
+		return p.ReleaseDate
+	case "mpaa_rating":
+		return p.MPAARating
+	case "runtime":
+		n = p.Runtime
+	case "rating":
+		n = p.Rating
+	}
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// setPayloadField MoviePayloadの項目にpayloadFieldの形式の値を設定する
+func setPayloadField(p *MoviePayload, field, value string) {
+	switch field {
+	case "title":
+		p.Title = value
+	case "description":
+		p.Description = value
+	case "release_date":
+		p.ReleaseDate = value
+	case "mpaa_rating":
+		p.MPAARating = value
+	case "runtime":
+		p.Runtime, _ = strconv.Atoi(value)
+	case "rating":
+		p.Rating, _ = strconv.Atoi(value)
+	}
+}
+
+// mergeMetadata 取り込んだメタデータincomingを現在の内容currentにマージする
+// 手動で編集した項目は上書きしない。項目を書き込むのは次のいずれかの場合だけ:
+//   - 現在の値が空
+//   - 以前に取り込んだ値（sources）のままで、その後に編集されていない
+func mergeMetadata(current, incoming MoviePayload, sources map[string]models.FieldSource) (MoviePayload, map[string]string, map[string]string) {
+	merged := current
+	applied := make(map[string]string)
+	skipped := make(map[string]string)
+
+	for _, field := range metadataFields {
+		cur, inc := payloadField(current, field), payloadField(incoming, field)
+		switch {
+		case inc == "":
+			skipped[field] = "not provided"
+		case inc == cur:
+			// 既に同じ値のため書き込まない
+		case cur == "":
+			setPayloadField(&merged, field, inc)
+			applied[field] = inc
+		case sources[field].Value == cur:
+			setPayloadField(&merged, field, inc)
+			applied[field] = inc
+		default:
+			skipped[field] = "edited manually"
+		}
+	}
+
+	return merged, applied, skipped
+}
+
+// lookupMovieByExternalID 外部IDに紐づく映画を返す
+func (app *application) lookupMovieByExternalID(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	source, externalID := params.ByName("source"), params.ByName("external_id")
+	if err := validateExternalIDs(map[string]string{source: externalID}); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	region, err := regionFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	id, err := app.models.DB.GetMovieIDByExternalID(source, externalID)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	movie, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	err = app.writeJSON(w, http.StatusOK, localizeMovie(regionalizeMovie(movie, region), preferredLocales(r)), "movie")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editMovieExternalIDs 映画の外部IDを置き換える
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieExternalIDs(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload ExternalIDsPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if err := validateExternalIDs(payload.ExternalIDs); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SetMovieExternalIDs(id, expectedVersion, payload.ExternalIDs)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err == models.ErrDuplicateExternalID {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// importMovieMetadata 映画の外部IDで提供元からメタデータを取得し、手動で編集されていない項目に取り込む
+// 外部IDはimdb、tmdbの順に試す。クエリパラメータ: dry_run (書き込まずに結果だけを返す)
+func (app *application) importMovieMetadata(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	if app.metadata == nil {
+		app.errorJSON(w, errors.New("no metadata provider is configured"), http.StatusServiceUnavailable)
+		return
+	}
+
+	version, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+	if len(before.ExternalIDs) == 0 {
+		app.errorJSON(w, errors.New("the movie has no external ids to look up"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	report := metadataReport{Provider: app.metadata.Name(), DryRun: r.URL.Query().Get("dry_run") == "true"}
+	var md *MovieMetadata
+	for _, source := range externalSources {
+		externalID, ok := before.ExternalIDs[source]
+		if !ok {
+			continue
+		}
+		md, err = app.metadata.Lookup(r.Context(), source, externalID)
+		if err == errMetadataNotFound {
+			continue
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadGateway)
+			return
+		}
+		report.Source, report.ExternalID = source, externalID
+		break
+	}
+	if md == nil {
+		app.errorJSON(w, errMetadataNotFound, http.StatusNotFound)
+		return
+	}
+
+	sources, err := app.models.DB.GetMovieFieldSources(id)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	merged, applied, skipped := mergeMetadata(payloadFromMovie(before), md.Movie, sources)
+	report.Applied, report.Skipped = applied, skipped
+
+	report.ExternalIDs = make(map[string]string)
+	for source, externalID := range md.ExternalIDs {
+		if _, ok := before.ExternalIDs[source]; !ok {
+			report.ExternalIDs[source] = externalID
+		}
+	}
+
+	// 取り込んだ結果も手動の編集や一括取り込みと同じ規則で検証する
+	now := time.Now()
+	item, errs := validateImport(importRecord{payload: ImportPayload{MoviePayload: merged}}, nil, now)
+	if len(errs) > 0 {
+		app.errorJSON(w, fmt.Errorf("imported metadata is invalid: %s %s", errs[0].Field, errs[0].Message), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !report.DryRun && (len(applied) > 0 || len(report.ExternalIDs) > 0) {
+		movie := *before
+		movie.Title = item.Movie.Title
+		movie.Description = item.Movie.Description
+		movie.ReleaseDate = item.Movie.ReleaseDate
+		movie.Year = item.Movie.Year
+		movie.Runtime = item.Movie.Runtime
+		movie.Rating = item.Movie.Rating
+		movie.MPAARating = item.Movie.MPAARating
+		movie.Version = version
+		movie.UpdatedAt = now
+
+		err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+			return db.ApplyMovieMetadata(movie, report.Provider, applied, report.ExternalIDs)
+		})
+		if err == models.ErrEditConflict {
+			app.errorJSON(w, err, http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+
+	}
+
+	err = app.writeJSON(w, http.StatusOK, report, "metadata")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
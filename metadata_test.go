@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"testing"
+	"time"
+)
+
+// TestMergeMetadataKeepsManualEdits フィクスチャから取り込み直しても、手動で編集した項目は残ること
+func TestMergeMetadataKeepsManualEdits(t *testing.T) {
+	provider, err := newFixtureProvider("fixtures/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := provider.Lookup(context.Background(), models.ExternalSourceIMDb, "tt0468569")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 以前に取り込んだ後、説明と上映時間を手動で編集し、レーティングを空にした映画
+	imported := time.Now().Add(-time.Hour)
+	sources := map[string]models.FieldSource{
+		"title":        {Provider: provider.Name(), Value: "The Dark Knight", UpdatedAt: imported},
+		"description":  {Provider: provider.Name(), Value: md.Movie.Description, UpdatedAt: imported},
+		"release_date": {Provider: provider.Name(), Value: "2008-07-18", UpdatedAt: imported},
+		"runtime":      {Provider: provider.Name(), Value: "152", UpdatedAt: imported},
+		"rating":       {Provider: provider.Name(), Value: "4", UpdatedAt: imported},
+	}
+	current := MoviePayload{
+		ID:          1,
+		Title:       "The Dark Knight",
+		Description: "Edited synopsis",
+		ReleaseDate: "2008-07-18",
+		Runtime:     150,
+		Rating:      4,
+		Version:     3,
+	}
+
+	merged, applied, skipped := mergeMetadata(current, md.Movie, sources)
+
+	if merged.Description != "Edited synopsis" || skipped["description"] != "edited manually" {
+		t.Errorf("description = %q (skipped %q), want the manual edit to survive", merged.Description, skipped["description"])
+	}
+	if merged.Runtime != 150 || skipped["runtime"] != "edited manually" {
+		t.Errorf("runtime = %d (skipped %q), want the manual edit to survive", merged.Runtime, skipped["runtime"])
+	}
+	// 以前に取り込んだ値のままの項目と空の項目は提供元の値で更新する
+	if merged.Rating != 5 || applied["rating"] != "5" {
+		t.Errorf("rating = %d (applied %q), want 5 from the provider", merged.Rating, applied["rating"])
+	}
+	if merged.MPAARating != "PG13" || applied["mpaa_rating"] != "PG13" {
+		t.Errorf("mpaa_rating = %q (applied %q), want PG13 from the provider", merged.MPAARating, applied["mpaa_rating"])
+	}
+	// 同じ値の項目は書き込まない
+	for _, field := range []string{"title", "release_date"} {
+		if _, ok := applied[field]; ok {
+			t.Errorf("%s was applied although it did not change", field)
+		}
+	}
+
+	item, errs := validateImport(importRecord{payload: ImportPayload{MoviePayload: merged}}, nil, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("merged metadata is invalid: %+v", errs)
+	}
+	if item.Movie.Description != "Edited synopsis" || item.Movie.Runtime != 150 {
+		t.Errorf("validated movie lost the manual edits: %+v", item.Movie)
+	}
+}
@@ -1,15 +1,67 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/pascaldekloe/jwt"
-	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// contextKey リクエストのcontextに値を格納する際のキー
+type contextKey string
+
+const (
+	contextKeyUserID    contextKey = "userID"
+	contextKeyRequestID contextKey = "requestID"
+	contextKeyConn      contextKey = "conn"
+)
+
+// saveConn http.ServerのConnContextに指定し、リクエストのcontextに接続を格納する
+func saveConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, contextKeyConn, c)
+}
+
+// connFromContext saveConnが格納した接続を返す。格納されていない場合はnilを返す
+func connFromContext(ctx context.Context) net.Conn {
+	c, _ := ctx.Value(contextKeyConn).(net.Conn)
+	return c
+}
+
+// userIDFromContext checkToken・identifyUserが格納したユーザーIDを返す。認証されていない場合は0を返す
+func userIDFromContext(ctx context.Context) int {
+	id, _ := ctx.Value(contextKeyUserID).(int)
+	return id
+}
+
+// requestIDFromContext assignRequestIDが格納したリクエストIDを返す
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID).(string)
+	return id
+}
+
+// assignRequestID リクエストにIDを割り当て、X-Request-IDヘッダーで返す
+// リクエストにX-Request-IDが含まれる場合はそれを引き継ぐ
+func (app *application) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")  // 全オリジンを許可（ドメイン）
@@ -25,65 +77,83 @@ func (app *application) checkToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
-		// Headerに含まれるAuthorizationの値を変数に切り出す
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			// could set an anonymous user
-			app.errorJSON(w, errors.New("unauhtorization"))
-			return
-		}
-
-		headerParts := strings.Split(authHeader, " ")
-
-		// 値が正しい構成になっているか
-		if len(headerParts) != 2 {
-			app.errorJSON(w, errors.New("invalid auth header"))
-			return
-		}
-
-		// 先頭に"Bearer"が含まれるか
-		if headerParts[0] != "Bearer" {
-			app.errorJSON(w, errors.New("unauthorized - no bearer"))
-			return
-		}
-
-		// tokenの値のみを切り出す
-		token := headerParts[1]
-
-		// tokenが不正なものでないかチェック
-		claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
+		userID, status, err := app.authenticate(r)
 		if err != nil {
-			app.errorJSON(w, errors.New("unauthorized - failed hmac check"), http.StatusForbidden)
-			return
-		}
-
-		// tokenが有効期限内かチェック
-		if !claims.Valid(time.Now()) {
-			app.errorJSON(w, errors.New("unauthorized - token expired"), http.StatusForbidden)
+			app.errorJSON(w, err, status)
 			return
 		}
 
-		// tokenの発行者が正しいかチェック
-		if claims.Issuer != "my_domain.com" {
-			app.errorJSON(w, errors.New("unauthorized - invalid issuer"), http.StatusForbidden)
-			return
-		}
+		// 後続のHandlerが利用できるようにユーザーIDをcontextに格納する
+		ctx := context.WithValue(r.Context(), contextKeyUserID, userID)
 
-		// tokenの想定利用者が正しいかチェック
-		if !claims.AcceptAudience("my_domain.com") {
-			app.errorJSON(w, errors.New("unauthorized - invalid audience"), http.StatusForbidden)
-			return
-		}
+		// 次のHandlerにチェーンする
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		userID, err := strconv.ParseInt(claims.Subject, 10, 64)
-		if err != nil {
-			app.errorJSON(w, errors.New("unauthorized"), http.StatusForbidden)
-			return
+// identifyUser 認証が必須でないルートで、有効なトークンがあればユーザーIDをcontextに格納する
+// トークンが無い・不正な場合は未ログインとして扱う
+func (app *application) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			if userID, _, err := app.authenticate(r); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyUserID, userID))
+			}
 		}
-
-		log.Println("UserID is " + strconv.Itoa(int(userID)))
-
-		// 次のHandlerにチェーンする
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticate AuthorizationヘッダーのJWTを検証してユーザーIDを返す
+// 検証に失敗した場合はエラーと、レスポンスに使うステータスコードを返す
+func (app *application) authenticate(r *http.Request) (int, int, error) {
+	// Headerに含まれるAuthorizationの値を変数に切り出す
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		// could set an anonymous user
+		return 0, http.StatusBadRequest, errors.New("unauhtorization")
+	}
+
+	headerParts := strings.Split(authHeader, " ")
+
+	// 値が正しい構成になっているか
+	if len(headerParts) != 2 {
+		return 0, http.StatusBadRequest, errors.New("invalid auth header")
+	}
+
+	// 先頭に"Bearer"が含まれるか
+	if headerParts[0] != "Bearer" {
+		return 0, http.StatusBadRequest, errors.New("unauthorized - no bearer")
+	}
+
+	// tokenの値のみを切り出す
+	token := headerParts[1]
+
+	// tokenが不正なものでないかチェック
+	claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
+	if err != nil {
+		return 0, http.StatusForbidden, errors.New("unauthorized - failed hmac check")
+	}
+
+	// tokenが有効期限内かチェック
+	if !claims.Valid(time.Now()) {
+		return 0, http.StatusForbidden, errors.New("unauthorized - token expired")
+	}
+
+	// tokenの発行者が正しいかチェック
+	if claims.Issuer != "my_domain.com" {
+		return 0, http.StatusForbidden, errors.New("unauthorized - invalid issuer")
+	}
+
+	// tokenの想定利用者が正しいかチェック
+	if !claims.AcceptAudience("my_domain.com") {
+		return 0, http.StatusForbidden, errors.New("unauthorized - invalid audience")
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, http.StatusForbidden, errors.New("unauthorized")
+	}
+
+	return int(userID), 0, nil
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// AuditEntry 管理操作の監査ログ
+type AuditEntry struct {
+	ID          int             `json:"id"`
+	ActorUserID int             `json:"actor_user_id"`
+	Action      string          `json:"action"`
+	Entity      string          `json:"entity"`
+	EntityID    int             `json:"entity_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Diff        json.RawMessage `json:"diff"`
+	RequestID   string          `json:"request_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// AuditFilter 監査ログの検索条件（ゼロ値の項目は条件に含めない）
+type AuditFilter struct {
+	ActorUserID int
+	Action      string
+	Entity      string
+	EntityID    int
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// fieldChange 変更されたフィールドの変更前と変更後の値
+type fieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// NewAuditEntry 変更前後の値をJSONにし、変更のあったフィールドの差分を含むAuditEntryを返す
+// 作成時はbefore、削除時はafterにnilを指定する
+func NewAuditEntry(actorUserID int, action, entity string, entityID int, before, after interface{}) (*AuditEntry, error) {
+	e := &AuditEntry{
+		ActorUserID: actorUserID,
+		Action:      action,
+		Entity:      entity,
+		EntityID:    entityID,
+	}
+
+	var err error
+	if e.Before, err = marshalNullable(before); err != nil {
+		return nil, err
+	}
+	if e.After, err = marshalNullable(after); err != nil {
+		return nil, err
+	}
+	if e.Diff, err = diffJSON(e.Before, e.After); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func marshalNullable(v interface{}) (json.RawMessage, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// diffJSON 2つのJSONオブジェクトのトップレベルのフィールドを比較し、変更されたものを返す
+func diffJSON(before, after json.RawMessage) (json.RawMessage, error) {
+	b := make(map[string]interface{})
+	a := make(map[string]interface{})
+	if before != nil {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := make(map[string]fieldChange)
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			diff[k] = fieldChange{From: v, To: a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = fieldChange{From: nil, To: v}
+		}
+	}
+
+	return json.Marshal(diff)
+}
+
+// InsertAuditEntry 監査ログを記録する
+func (m *DBModel) InsertAuditEntry(e *AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO audit_log (actor_user_id, action, entity, entity_id, before, after, diff, request_id, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := m.conn().ExecContext(ctx, query,
+		e.ActorUserID,
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		nullableJSON(e.Before),
+		nullableJSON(e.After),
+		nullableJSON(e.Diff),
+		e.RequestID,
+		time.Now(),
+	)
+
+	return err
+}
+
+// nullableJSON 空のJSONをNULLとして渡すための値を返す
+func nullableJSON(js json.RawMessage) interface{} {
+	if len(js) == 0 {
+		return nil
+	}
+	return string(js)
+}
+
+// GetAuditEntries 条件に一致する監査ログを新しい順に返す
+func (m *DBModel) GetAuditEntries(f AuditFilter) ([]*AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var conds []string
+	var params []interface{}
+	addCond := func(format string, v interface{}) {
+		params = append(params, v)
+		conds = append(conds, fmt.Sprintf(format, len(params)))
+	}
+
+	if f.ActorUserID > 0 {
+		addCond("actor_user_id = $%d", f.ActorUserID)
+	}
+	if f.Action != "" {
+		addCond("action = $%d", f.Action)
+	}
+	if f.Entity != "" {
+		addCond("entity = $%d", f.Entity)
+	}
+	if f.EntityID > 0 {
+		addCond("entity_id = $%d", f.EntityID)
+	}
+	if !f.Since.IsZero() {
+		addCond("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		addCond("created_at < $%d", f.Until)
+	}
+
+	var where string
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	limit := f.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	params = append(params, limit)
+
+	query := fmt.Sprintf(`SELECT id, actor_user_id, action, entity, entity_id, before, after, diff, request_id, created_at
+				FROM audit_log %s ORDER BY created_at DESC, id DESC LIMIT $%d`, where, len(params))
+
+	rows, err := m.conn().QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var before, after, diff []byte
+		err := rows.Scan(
+			&e.ID,
+			&e.ActorUserID,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&before,
+			&after,
+			&diff,
+			&e.RequestID,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		e.Before, e.After, e.Diff = before, after, diff
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
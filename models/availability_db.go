@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateProvider 同じスラッグの配信サービスが既にある
+var ErrDuplicateProvider = errors.New("a provider with this slug already exists")
+
+// GetProviders 配信サービスを名前順に返す
+func (m *DBModel) GetProviders() ([]*Provider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.conn().QueryContext(ctx, `SELECT id, slug, name, url, created_at, updated_at FROM providers ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []*Provider{}
+	for rows.Next() {
+		var p Provider
+		if err := rows.Scan(&p.ID, &p.Slug, &p.Name, &p.URL, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		providers = append(providers, &p)
+	}
+
+	return providers, rows.Err()
+}
+
+// GetProvider IDに一致する配信サービスを返す
+func (m *DBModel) GetProvider(id int) (*Provider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p Provider
+	row := m.conn().QueryRowContext(ctx, `SELECT id, slug, name, url, created_at, updated_at FROM providers WHERE id = $1`, id)
+	if err := row.Scan(&p.ID, &p.Slug, &p.Name, &p.URL, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// InsertProvider 配信サービスを新規作成し、採番されたIDを返す
+// スラッグが既に使われている場合はErrDuplicateProviderを返す
+func (m *DBModel) InsertProvider(p Provider) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO providers (slug, name, url, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (slug) DO NOTHING
+				RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, p.Slug, p.Name, p.URL, p.CreatedAt, p.UpdatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrDuplicateProvider
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateProvider 配信サービスのスラッグ・名前・URLを更新し、その配信サービスで配信している映画のバージョンを1つ進める
+// 存在しない場合はsql.ErrNoRowsを、スラッグが他の配信サービスで使われている場合はErrDuplicateProviderを返す
+func (m *DBModel) UpdateProvider(p Provider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM providers WHERE slug = $1 AND id <> $2)`, p.Slug, p.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateProvider
+	}
+
+	query := `UPDATE providers SET slug = $1, name = $2, url = $3, updated_at = $4 WHERE id = $5`
+	result, err := tx.ExecContext(ctx, query, p.Slug, p.Name, p.URL, p.UpdatedAt, p.ID)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+	if err := reviseMovies(ctx, tx, p.UpdatedAt, `SELECT movie_id FROM movie_availability WHERE provider_id = $1`, p.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateProviders()
+
+	return nil
+}
+
+// DeleteProvider 配信サービスとその配信を削除する（配信していた映画のバージョンは1つ進める）
+// 存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteProvider(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reviseMovies(ctx, tx, time.Now(), `SELECT movie_id FROM movie_availability WHERE provider_id = $1`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM providers WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateProviders()
+
+	return nil
+}
+
+// SetMovieAvailability 映画の配信をavailabilityで置き換え、映画のバージョンを1つ進める
+// versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) SetMovieAvailability(movieID, version int, availability []Availability) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movie_availability WHERE movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_availability
+				(movie_id, provider_id, region, offer_type, price, currency, url, valid_from, valid_to, created_at)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10)`
+	for _, a := range availability {
+		_, err := tx.ExecContext(ctx, query,
+			movieID, a.ProviderID, a.Region, a.Type, a.Price, a.Currency, a.URL, a.ValidFrom, a.ValidTo, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// getMovieAvailability 映画の配信を提供期間外のものも含めて、国・配信サービス・提供形態の順に返す
+func (m *DBModel) getMovieAvailability(ctx context.Context, movieID int) ([]*Availability, error) {
+	query := `SELECT a.id, a.movie_id, a.provider_id, p.slug, p.name, a.region, a.offer_type,
+				a.price, COALESCE(a.currency, ''), a.url, a.valid_from, a.valid_to
+				FROM movie_availability a
+				INNER JOIN providers p ON (p.id = a.provider_id)
+				WHERE a.movie_id = $1
+				ORDER BY a.region, p.name, a.offer_type`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	availability := []*Availability{}
+	for rows.Next() {
+		var a Availability
+		err := rows.Scan(&a.ID, &a.MovieID, &a.ProviderID, &a.ProviderSlug, &a.ProviderName, &a.Region, &a.Type,
+			&a.Price, &a.Currency, &a.URL, &a.ValidFrom, &a.ValidTo)
+		if err != nil {
+			return nil, err
+		}
+		availability = append(availability, &a)
+	}
+
+	return availability, rows.Err()
+}
+
+// invalidateProviders 配信サービスの書き込み後に、配信サービス名を含む映画のキャッシュを破棄する
+func (m *DBModel) invalidateProviders() {
+	m.Cache.DeletePrefix(cacheKeyMovie)
+	m.Cache.DeletePrefix(cacheKeyMovies)
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache DBModelの読み込み結果を保持するキャッシュ
+// 保持する値は複数のリクエストで共有されるため、取り出した側で変更してはならない
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	// DeletePrefix prefixで始まるキーを全て削除する
+	DeletePrefix(prefix string)
+	Stats() CacheStats
+}
+
+// CacheStats キャッシュのヒット率などの統計
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// noCache 何も保持しないキャッシュ
+type noCache struct {
+	misses uint64
+}
+
+func (c *noCache) Get(key string) (interface{}, bool) {
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+func (c *noCache) Set(key string, value interface{}) {}
+
+func (c *noCache) DeletePrefix(prefix string) {}
+
+func (c *noCache) Stats() CacheStats {
+	return CacheStats{Misses: atomic.LoadUint64(&c.misses)}
+}
+
+// NewNoCache キャッシュを無効にする場合のCacheを返す
+func NewNoCache() Cache {
+	return &noCache{}
+}
+
+// LRUCache 件数の上限と有効期限を持つプロセス内のLRUキャッシュ
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[string]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// NewLRUCache 最大size件をttlの間保持するLRUキャッシュを返す
+// ttlが0の場合は有効期限を設けない
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		c.misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits++
+	return e.value, true
+}
+
+func (c *LRUCache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value = value
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *LRUCache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.ll.Len(),
+	}
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
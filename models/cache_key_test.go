@@ -0,0 +1,19 @@
+package models
+
+import "testing"
+
+// TestInvalidateMovieKeepsOtherMovies 映画のキャッシュの破棄は、IDが同じ数字で始まる他の映画に影響しないこと
+func TestInvalidateMovieKeepsOtherMovies(t *testing.T) {
+	m := &DBModel{Cache: NewLRUCache(10, 0)}
+	m.Cache.Set(movieCacheKey(1), &Movie{ID: 1})
+	m.Cache.Set(movieCacheKey(10), &Movie{ID: 10})
+
+	m.invalidateMovie(1)
+
+	if _, ok := m.Cache.Get(movieCacheKey(1)); ok {
+		t.Error("movie 1 is still cached")
+	}
+	if _, ok := m.Cache.Get(movieCacheKey(10)); !ok {
+		t.Error("movie 10 was evicted by invalidating movie 1")
+	}
+}
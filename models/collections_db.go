@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateSlug 同じスラッグの特集が既にある
+var ErrDuplicateSlug = errors.New("a collection with this slug already exists")
+
+const collectionColumns = `c.id, c.slug, c.title, c.description, c.created_at, c.updated_at,
+				(SELECT count(*) FROM collection_movies cm
+					INNER JOIN movies m ON (m.id = cm.movie_id)
+					WHERE cm.collection_id = c.id AND m.deleted_at IS NULL)`
+
+func scanCollection(row scanner, c *Collection) error {
+	return row.Scan(
+		&c.ID,
+		&c.Slug,
+		&c.Title,
+		&c.Description,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.MovieCount,
+	)
+}
+
+// GetCollections 特集を新しく更新された順に返す（映画は含めない）
+func (m *DBModel) GetCollections() ([]*Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.conn().QueryContext(ctx, `SELECT `+collectionColumns+` FROM collections c ORDER BY c.updated_at DESC, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+	for rows.Next() {
+		var c Collection
+		if err := scanCollection(rows, &c); err != nil {
+			return nil, err
+		}
+		collections = append(collections, &c)
+	}
+
+	return collections, rows.Err()
+}
+
+// GetCollection スラッグに一致する特集を、映画（ゴミ箱にあるものを除く）を特集内の順に並べて返す
+func (m *DBModel) GetCollection(slug string) (*Collection, error) {
+	return m.getCollection(`c.slug = $1`, slug)
+}
+
+// GetCollectionByID IDに一致する特集を映画と合わせて返す
+func (m *DBModel) GetCollectionByID(id int) (*Collection, error) {
+	return m.getCollection(`c.id = $1`, id)
+}
+
+func (m *DBModel) getCollection(cond string, arg interface{}) (*Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c Collection
+	row := m.conn().QueryRowContext(ctx, `SELECT `+collectionColumns+` FROM collections c WHERE `+cond, arg)
+	if err := scanCollection(row, &c); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT cm.movie_id FROM collection_movies cm
+				INNER JOIN movies m ON (m.id = cm.movie_id)
+				WHERE cm.collection_id = $1 AND m.deleted_at IS NULL
+				ORDER BY cm.position`
+	rows, err := m.conn().QueryContext(ctx, query, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	c.Movies = make([]*Movie, 0, len(ids))
+	for _, id := range ids {
+		movie, err := m.GetMovie(id)
+		if err != nil {
+			return nil, err
+		}
+		c.Movies = append(c.Movies, movie)
+	}
+
+	return &c, nil
+}
+
+// InsertCollection 特集を新規作成し、採番されたIDを返す
+// スラッグが既に使われている場合はErrDuplicateSlugを返す
+func (m *DBModel) InsertCollection(c Collection) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO collections (slug, title, description, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (slug) DO NOTHING
+				RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, c.Slug, c.Title, c.Description, c.CreatedAt, c.UpdatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrDuplicateSlug
+	}
+	if err != nil {
+		return 0, err
+	}
+	m.invalidateCollections()
+
+	return id, nil
+}
+
+// UpdateCollection 特集のスラッグ・タイトル・説明を更新する
+// 存在しない場合はsql.ErrNoRowsを、スラッグが他の特集で使われている場合はErrDuplicateSlugを返す
+func (m *DBModel) UpdateCollection(c Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var taken bool
+	err := m.conn().QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM collections WHERE slug = $1 AND id <> $2)`, c.Slug, c.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateSlug
+	}
+
+	query := `UPDATE collections SET slug = $1, title = $2, description = $3, updated_at = $4 WHERE id = $5`
+	result, err := m.conn().ExecContext(ctx, query, c.Slug, c.Title, c.Description, c.UpdatedAt, c.ID)
+	if err != nil {
+		return err
+	}
+	m.invalidateCollections()
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// DeleteCollection 特集を削除する（映画は削除しない）。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteCollection(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	m.invalidateCollections()
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// SetCollectionMovies 特集の映画をmovieIDsの順に置き換える。追加・削除・並び替えをまとめて行う
+// 特集が存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) SetCollectionMovies(id int, movieIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE collections SET updated_at = $1 WHERE id = $2`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM collection_movies WHERE collection_id = $1`, id); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO collection_movies (collection_id, movie_id, position) VALUES ($1, $2, $3)`
+	for i, movieID := range movieIDs {
+		if _, err := tx.ExecContext(ctx, query, id, movieID, i+1); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateCollections()
+
+	return nil
+}
+
+// invalidateCollections 特集の書き込み後に、特集の件数を含む集計のキャッシュを破棄する
+func (m *DBModel) invalidateCollections() {
+	m.Cache.DeletePrefix(cacheKeyStats)
+}
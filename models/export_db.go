@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// exportFetchSize サーバーサイドカーソルから1度に読み込む件数
+const exportFetchSize = 500
+
+// ExportMovies 絞り込み条件に一致する映画をID順に1件ずつfnに渡す
+// サーバーサイドカーソルで少しずつ読み込むため、件数が多くても全件をメモリに載せない
+// fnがエラーを返した場合は読み込みを中断してそのエラーを返す
+func (m *DBModel) ExportMovies(ctx context.Context, f MovieFilter, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	conds, params := f.conditions()
+
+	// ジャンルはmovies_genresのIDをキーにしたJSONオブジェクトとしてまとめて読み込む
+	query := fmt.Sprintf(`DECLARE export_movies NO SCROLL CURSOR FOR
+				SELECT %s,
+					COALESCE((SELECT json_object_agg(mg.id, g.genre_name)
+						FROM movies_genres mg
+						INNER JOIN genres g ON (g.id = mg.genre_id)
+						WHERE mg.movie_id = movies.id), '{}')
+				FROM movies
+				WHERE %s
+				ORDER BY id`, movieColumns, strings.Join(conds, " AND "))
+
+	if _, err := tx.ExecContext(ctx, query, params...); err != nil {
+		return err
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM export_movies`, exportFetchSize))
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			var movie Movie
+			var genres []byte
+			err := scanMovie(rows, &movie, &genres)
+			if err == nil {
+				err = json.Unmarshal(genres, &movie.MovieGenre)
+			}
+			if err == nil {
+				err = fn(&movie)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if n < exportFetchSize {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateExternalID 外部IDが既に他の映画に紐づいている
+var ErrDuplicateExternalID = errors.New("the external id is already linked to another movie")
+
+// GetMovieIDByExternalID 外部IDに紐づく映画（ゴミ箱にあるものを除く）のIDを返す
+// 見つからない場合はsql.ErrNoRowsを返す
+func (m *DBModel) GetMovieIDByExternalID(source, externalID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT e.movie_id FROM movie_external_ids e
+				INNER JOIN movies m ON (m.id = e.movie_id)
+				WHERE e.source = $1 AND e.external_id = $2 AND m.deleted_at IS NULL`
+	var id int
+	if err := m.conn().QueryRowContext(ctx, query, source, externalID).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// SetMovieExternalIDs 映画の外部IDをidsで置き換え、映画のバージョンを1つ進める
+// 他の映画に紐づいている外部IDがある場合はErrDuplicateExternalIDを返す
+// versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) SetMovieExternalIDs(movieID, version int, ids map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	for source, externalID := range ids {
+		var taken bool
+		query := `SELECT EXISTS (SELECT 1 FROM movie_external_ids WHERE source = $1 AND external_id = $2 AND movie_id <> $3)`
+		if err := tx.QueryRowContext(ctx, query, source, externalID, movieID).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateExternalID
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movie_external_ids WHERE movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_external_ids (movie_id, source, external_id, created_at) VALUES ($1, $2, $3, $4)`
+	for source, externalID := range ids {
+		if _, err := tx.ExecContext(ctx, query, movieID, source, externalID, now); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// GetMovieFieldSources 映画の項目のうち、外部から取り込んで書き込んだものを項目名をキーにして返す
+func (m *DBModel) GetMovieFieldSources(movieID int) (map[string]FieldSource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.conn().QueryContext(ctx, `SELECT field, provider, value, updated_at FROM movie_field_sources WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := make(map[string]FieldSource)
+	for rows.Next() {
+		var field string
+		var fs FieldSource
+		if err := rows.Scan(&field, &fs.Provider, &fs.Value, &fs.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sources[field] = fs
+	}
+
+	return sources, rows.Err()
+}
+
+// ApplyMovieMetadata 外部から取り込んだ内容で映画を更新し、書き込んだ項目fieldsの値を記録する
+// externalIDsのうち、まだ紐づいていない外部IDも追加する（他の映画に紐づいているものは無視する）
+// movie.Versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) ApplyMovieMetadata(movie Movie, provider string, fields, externalIDs map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateMovie(ctx, tx, movie); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_field_sources (movie_id, field, provider, value, updated_at) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (movie_id, field) DO UPDATE
+				SET provider = EXCLUDED.provider, value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`
+	for field, value := range fields {
+		if _, err := tx.ExecContext(ctx, query, movie.ID, field, provider, value, movie.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	query = `INSERT INTO movie_external_ids (movie_id, source, external_id, created_at) VALUES ($1, $2, $3, $4)
+				ON CONFLICT DO NOTHING`
+	for source, externalID := range externalIDs {
+		if _, err := tx.ExecContext(ctx, query, movie.ID, source, externalID, movie.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movie.ID)
+
+	return nil
+}
+
+// getMovieExternalIDs 映画の外部IDを提供元をキーにしたmapで返す
+func (m *DBModel) getMovieExternalIDs(ctx context.Context, movieID int) (map[string]string, error) {
+	rows, err := m.conn().QueryContext(ctx, `SELECT source, external_id FROM movie_external_ids WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]string)
+	for rows.Next() {
+		var source, externalID string
+		if err := rows.Scan(&source, &externalID); err != nil {
+			return nil, err
+		}
+		ids[source] = externalID
+	}
+
+	return ids, rows.Err()
+}
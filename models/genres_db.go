@@ -2,15 +2,31 @@ package models
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// GetAllGenres 全てのGenreインスタンスを返す
 func (m *DBModel) GetAllGenres() ([]*Genre, error) {
+	if v, ok := m.Cache.Get(cacheKeyGenres); ok {
+		return v.([]*Genre), nil
+	}
+
+	gs, err := m.getAllGenres()
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.Set(cacheKeyGenres, gs)
+
+	return gs, nil
+}
+
+func (m *DBModel) getAllGenres() ([]*Genre, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `SELECT id, genre_name, created_at, updated_at FROM genres`
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.conn().QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -35,3 +51,118 @@ func (m *DBModel) GetAllGenres() ([]*Genre, error) {
 
 	return gs, nil
 }
+
+// GenresValidator ジャンル一覧の件数と最終更新日時を返す
+func (m *DBModel) GenresValidator() (*Validator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT count(*), COALESCE(max(updated_at), 'epoch') FROM genres`
+
+	var v Validator
+	err := m.conn().QueryRowContext(ctx, query).Scan(&v.Count, &v.LastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// ErrDuplicateGenre 同じ名前のジャンルが既にある
+var ErrDuplicateGenre = errors.New("a genre with this name already exists")
+
+// GetGenre IDに一致するジャンルを返す
+func (m *DBModel) GetGenre(id int) (*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g Genre
+	row := m.conn().QueryRowContext(ctx, `SELECT id, genre_name, created_at, updated_at FROM genres WHERE id = $1`, id)
+	if err := row.Scan(&g.ID, &g.GenreName, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// InsertGenre ジャンルを新規作成し、採番されたIDを返す
+// 同じ名前（大文字・小文字を区別しない）のジャンルがある場合はErrDuplicateGenreを返す
+func (m *DBModel) InsertGenre(g Genre) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.checkGenreName(ctx, g.GenreName, 0); err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO genres (genre_name, created_at, updated_at) VALUES ($1, $2, $3) RETURNING id`
+	var id int
+	if err := m.conn().QueryRowContext(ctx, query, g.GenreName, g.CreatedAt, g.UpdatedAt).Scan(&id); err != nil {
+		return 0, err
+	}
+	m.InvalidateGenres()
+
+	return id, nil
+}
+
+// UpdateGenre ジャンルの名前を変更する
+// 存在しない場合はsql.ErrNoRowsを、名前が他のジャンルで使われている場合はErrDuplicateGenreを返す
+func (m *DBModel) UpdateGenre(g Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.checkGenreName(ctx, g.GenreName, g.ID); err != nil {
+		return err
+	}
+
+	result, err := m.conn().ExecContext(ctx, `UPDATE genres SET genre_name = $1, updated_at = $2 WHERE id = $3`, g.GenreName, g.UpdatedAt, g.ID)
+	if err != nil {
+		return err
+	}
+	m.InvalidateGenres()
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// DeleteGenre ジャンルを削除し、映画との紐付けも外す。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteGenre(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movies_genres WHERE genre_id = $1`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.InvalidateGenres()
+
+	return nil
+}
+
+// checkGenreName nameが自身（id）以外のジャンルで使われている場合はErrDuplicateGenreを返す
+func (m *DBModel) checkGenreName(ctx context.Context, name string, id int) error {
+	var taken bool
+	err := m.conn().QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM genres WHERE lower(genre_name) = lower($1) AND id <> $2)`, name, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateGenre
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+const imageColumns = `id, movie_id, kind, key, thumbnail_key, url, thumbnail_url, content_type, width, height, size, created_at`
+
+func scanImage(row scanner, img *MovieImage) error {
+	return row.Scan(
+		&img.ID,
+		&img.MovieID,
+		&img.Kind,
+		&img.Key,
+		&img.ThumbnailKey,
+		&img.URL,
+		&img.ThumbnailURL,
+		&img.ContentType,
+		&img.Width,
+		&img.Height,
+		&img.Size,
+		&img.CreatedAt,
+	)
+}
+
+// GetMovieImage 映画に添付された画像を1件返す
+func (m *DBModel) GetMovieImage(movieID, id int) (*MovieImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var img MovieImage
+	row := m.conn().QueryRowContext(ctx, `SELECT `+imageColumns+` FROM movie_images WHERE movie_id = $1 AND id = $2`, movieID, id)
+	if err := scanImage(row, &img); err != nil {
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+// InsertMovieImage 映画に画像を添付し、映画のバージョンを1つ進める
+// versionが0でない場合は保存されているバージョンと一致するときだけ添付し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) InsertMovieImage(img MovieImage, version int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := snapshotMovie(ctx, tx, img.MovieID, version, img.CreatedAt); err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO movie_images (movie_id, kind, key, thumbnail_key, url, thumbnail_url, content_type,
+				width, height, size, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+	var id int
+	err = tx.QueryRowContext(ctx, query,
+		img.MovieID,
+		img.Kind,
+		img.Key,
+		img.ThumbnailKey,
+		img.URL,
+		img.ThumbnailURL,
+		img.ContentType,
+		img.Width,
+		img.Height,
+		img.Size,
+		img.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, img.CreatedAt, img.MovieID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	m.invalidateMovie(img.MovieID)
+
+	return id, nil
+}
+
+// DeleteMovieImage 映画から画像を外し、映画のバージョンを1つ進める
+// 画像が無い場合はsql.ErrNoRowsを、バージョンが一致しない場合はErrEditConflictを返す
+func (m *DBModel) DeleteMovieImage(img MovieImage, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, img.MovieID, version, now); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM movie_images WHERE movie_id = $1 AND id = $2`, img.MovieID, img.ID)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, img.MovieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(img.MovieID)
+
+	return nil
+}
+
+// getMovieImages 映画に添付された画像をポスター・背景画像の順に、それぞれ添付した順で返す
+func (m *DBModel) getMovieImages(ctx context.Context, movieID int) ([]*MovieImage, error) {
+	query := `SELECT ` + imageColumns + ` FROM movie_images WHERE movie_id = $1 ORDER BY kind DESC, id`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*MovieImage{}
+	for rows.Next() {
+		var img MovieImage
+		if err := scanImage(rows, &img); err != nil {
+			return nil, err
+		}
+		images = append(images, &img)
+	}
+
+	return images, rows.Err()
+}
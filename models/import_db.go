@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ImportMovie 一括取り込みの1件
+// GenreIDsがnilの場合、既存の映画のジャンルは変更しない
+// Movie.IDが0でない場合はそのIDの映画を更新し、Movie.Versionが0でない場合は保存されているバージョンと一致するときだけ更新する
+// Fieldsがnilでない場合、既存の映画はFieldsに含まれる項目（description・runtime・rating・mpaa_rating）だけを更新する
+type ImportMovie struct {
+	Movie    Movie
+	GenreIDs []int
+	Fields   map[string]bool
+}
+
+// ImportOutcome 一括取り込みの1件ごとの結果
+// Beforeは既存の映画を更新した場合の更新前の状態
+type ImportOutcome struct {
+	ID      int
+	Created bool
+	Before  *Movie
+	Err     error
+}
+
+// ImportOptions 一括取り込みの動作
+type ImportOptions struct {
+	// DryRun 全ての書き込みを最後にロールバックする
+	DryRun bool
+	// Atomic 1件でも失敗した場合は全件をロールバックする
+	Atomic bool
+}
+
+// ImportMovies タイトルと公開年が一致する映画があれば更新し、無ければ作成する
+// 各件の結果をitemsと同じ順に返す。件ごとの失敗はImportOutcome.Errに入れ、
+// トランザクション自体の失敗のみerrorとして返す
+// recordがnilでなければ、書き込めた件ごとに同じトランザクションで呼び出す。エラーを返した場合はその件を失敗とする
+func (m *DBModel) ImportMovies(items []ImportMovie, opts ImportOptions, record func(db *DBModel, o ImportOutcome) error) ([]ImportOutcome, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	outcomes := make([]ImportOutcome, len(items))
+	err := m.Tx(func(db *DBModel) error {
+		tx := db.tx
+
+		failed := false
+		for i, item := range items {
+			// 1件の失敗でトランザクション全体が中断されないよう、件ごとにセーブポイントを置く
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+				return err
+			}
+
+			outcomes[i] = upsertMovie(ctx, db, item)
+			if outcomes[i].Err == nil && record != nil {
+				outcomes[i].Err = record(db, outcomes[i])
+			}
+
+			if outcomes[i].Err != nil {
+				failed = true
+				if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`); err != nil {
+				return err
+			}
+		}
+
+		if opts.DryRun || (opts.Atomic && failed) {
+			return errRollback
+		}
+
+		for _, o := range outcomes {
+			if o.Err == nil {
+				db.invalidateMovie(o.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// upsertMovie 既存の映画を探して更新し、無ければ作成する
+// IDが指定されている場合はIDで探し（見つからなければ失敗とする）、それ以外はタイトル（大文字小文字を区別しない）と公開年で探す
+func upsertMovie(ctx context.Context, db *DBModel, item ImportMovie) ImportOutcome {
+	movie := item.Movie
+	tx := db.conn()
+
+	var id int
+	var err error
+	if movie.ID != 0 {
+		err = tx.QueryRowContext(ctx, `SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL`, movie.ID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ImportOutcome{Err: fmt.Errorf("no movie with id %d", movie.ID)}
+		}
+	} else {
+		query := `SELECT id FROM movies WHERE lower(title) = lower($1) AND year = $2 AND deleted_at IS NULL
+				ORDER BY id LIMIT 1`
+		err = tx.QueryRowContext(ctx, query, movie.Title, movie.Year).Scan(&id)
+	}
+
+	var o ImportOutcome
+	switch {
+	case err == sql.ErrNoRows:
+		o.Created = true
+		movie.ID, err = insertMovie(ctx, tx, movie)
+	case err == nil:
+		movie.ID = id
+		if o.Before, err = db.GetMovie(id); err != nil {
+			break
+		}
+		// 入力に無い項目は今の値のままにする
+		if item.Fields != nil {
+			if !item.Fields["description"] {
+				movie.Description = o.Before.Description
+			}
+			if !item.Fields["runtime"] {
+				movie.Runtime = o.Before.Runtime
+			}
+			if !item.Fields["rating"] {
+				movie.Rating = o.Before.Rating
+			}
+			if !item.Fields["mpaa_rating"] {
+				movie.MPAARating = o.Before.MPAARating
+			}
+		}
+		err = updateMovie(ctx, tx, movie)
+	}
+	if err != nil {
+		o.Err = err
+		return o
+	}
+	o.ID = movie.ID
+
+	// ジャンルが指定されていない場合は既存の紐付けを残す
+	if item.GenreIDs == nil {
+		return o
+	}
+	if err := setMovieGenres(ctx, tx, movie.ID, item.GenreIDs, movie.UpdatedAt); err != nil {
+		o.Err = fmt.Errorf("genres: %v", err)
+	}
+
+	return o
+}
+
+// setMovieGenres 映画に紐づくジャンルをgenreIDsで置き換える
+func setMovieGenres(ctx context.Context, tx dbtx, movieID int, genreIDs []int, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movies_genres WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movies_genres (movie_id, genre_id, created_at, updated_at) VALUES ($1, $2, $3, $3)`
+	for _, genreID := range genreIDs {
+		if _, err := tx.ExecContext(ctx, query, movieID, genreID, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
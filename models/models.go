@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -11,25 +12,60 @@ type Models struct {
 }
 
 // NewModels DBのコネクションプールを管理するsql.DBインスタンスを持つ
-//           modelsを返す
-func NewModels(db *sql.DB) Models {
+//
+//	modelsを返す
+//	cacheがnilの場合は読み込み結果をキャッシュしない
+func NewModels(db *sql.DB, cache Cache) Models {
+	if cache == nil {
+		cache = NewNoCache()
+	}
 	return Models{
-		DB: DBModel{DB: db},
+		DB: DBModel{DB: db, Cache: cache},
 	}
 }
 
+// Movie 映画
+// InWatchlistはログインしているユーザーのウォッチリストにあるかで、未ログインの場合はnil
+// Locale・OriginalTitleは翻訳を適用した場合のみ設定する
+// Region・Certificationは地域を指定した場合のみ設定し、ReleaseDateはその地域の公開日になる
+// Availabilityは提供期間外のものも含むため、レスポンスでは現在視聴できるものに絞り込む
+// RelatedModifiedはクレジットの人物とジャンルの最終更新日時で、映画のバージョンを進めない名前の変更をETagに反映するために使う
+// GetMovie・GetAllMoviesなどが返すMovieはキャッシュされ、他のリクエストと共有される。
+// リクエストごとに内容を変える場合は変更せずに複製を作る
 type Movie struct {
-	ID          int            `json:"id"`
-	Title       string         `json:"title"`
-	Description string         `json:"description"`
-	Year        int            `json:"year"`
-	ReleaseDate time.Time      `json:"release_date"`
-	Runtime     int            `json:"runtime"`
-	Rating      int            `json:"rating"`
-	MPAARating  string         `json:"mpaa_rating"`
-	CreatedAt   time.Time      `json:"-"`
-	UpdatedAt   time.Time      `json:"-"`
-	MovieGenre  map[int]string `json:"genres"`
+	ID              int                          `json:"id"`
+	Title           string                       `json:"title"`
+	Description     string                       `json:"description"`
+	Year            int                          `json:"year"`
+	ReleaseDate     time.Time                    `json:"release_date"`
+	Runtime         int                          `json:"runtime"`
+	Rating          int                          `json:"rating"`
+	MPAARating      string                       `json:"mpaa_rating"`
+	Version         int                          `json:"version"`
+	CreatedAt       time.Time                    `json:"-"`
+	UpdatedAt       time.Time                    `json:"-"`
+	DeletedAt       *time.Time                   `json:"deleted_at,omitempty"`
+	MovieGenre      map[int]string               `json:"genres"`
+	Credits         []*Credit                    `json:"credits"`
+	ReviewStats     *ReviewStats                 `json:"review_stats"`
+	Images          []*MovieImage                `json:"images"`
+	InWatchlist     *bool                        `json:"in_watchlist,omitempty"`
+	Locale          string                       `json:"locale,omitempty"`
+	OriginalTitle   string                       `json:"original_title,omitempty"`
+	Translations    map[string]*MovieTranslation `json:"-"`
+	Tags            []string                     `json:"tags"`
+	ExternalIDs     map[string]string            `json:"external_ids"`
+	Releases        []*Release                   `json:"releases"`
+	Region          string                       `json:"region,omitempty"`
+	Certification   string                       `json:"certification,omitempty"`
+	Availability    []*Availability              `json:"availability"`
+	RelatedModified time.Time                    `json:"-"`
+}
+
+// Validator 一覧の条件付きGETに利用する件数と最終更新日時
+type Validator struct {
+	Count        int
+	LastModified time.Time
 }
 
 type Genre struct {
@@ -48,8 +84,359 @@ type MovieGenre struct {
 	UpdatedAt time.Time `json:"-"`
 }
 
+// クレジットの役割
+const (
+	CreditActor    = "actor"
+	CreditDirector = "director"
+	CreditWriter   = "writer"
+)
+
+// Person 出演者・監督・脚本家
+type Person struct {
+	ID          int                 `json:"id"`
+	Name        string              `json:"name"`
+	Biography   string              `json:"biography"`
+	BirthDate   *time.Time          `json:"birth_date"`
+	CreatedAt   time.Time           `json:"-"`
+	UpdatedAt   time.Time           `json:"-"`
+	Filmography []*FilmographyEntry `json:"filmography,omitempty"`
+}
+
+// Credit 映画に対する人物の役割（俳優の場合は役名を含む）
+type Credit struct {
+	ID         int    `json:"id"`
+	MovieID    int    `json:"-"`
+	PersonID   int    `json:"person_id"`
+	PersonName string `json:"person_name"`
+	Role       string `json:"role"`
+	Character  string `json:"character"`
+	Order      int    `json:"order"`
+}
+
+// FilmographyEntry 人物が関わった映画とその役割
+type FilmographyEntry struct {
+	MovieID   int    `json:"movie_id"`
+	Title     string `json:"title"`
+	Year      int    `json:"year"`
+	Role      string `json:"role"`
+	Character string `json:"character"`
+}
+
+// MovieTranslation 映画のタイトル・あらすじの翻訳
+type MovieTranslation struct {
+	MovieID     int       `json:"-"`
+	Locale      string    `json:"locale"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 公開の種類
+const (
+	ReleaseTheatrical = "theatrical"
+	ReleaseDigital    = "digital"
+)
+
+// Release 国ごとの映画の公開日とレーティング
+// CountryはISO 3166-1 alpha-2の国コード、Certificationはその国の区分（空は未設定）
+type Release struct {
+	ID            int       `json:"id"`
+	MovieID       int       `json:"-"`
+	Country       string    `json:"country"`
+	Type          string    `json:"type"`
+	Date          time.Time `json:"date"`
+	Certification string    `json:"certification"`
+}
+
+// 配信の提供形態
+const (
+	OfferSubscription = "subscription"
+	OfferRent         = "rent"
+	OfferBuy          = "buy"
+)
+
+// Provider 映画を配信するサービス
+type Provider struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Availability 映画を視聴できる配信サービス・国・提供形態と、その提供期間
+// Price・Currencyは見放題の場合は省略できる。ValidFrom・ValidToがnilの場合は期限なし
+type Availability struct {
+	ID           int        `json:"id"`
+	MovieID      int        `json:"-"`
+	ProviderID   int        `json:"provider_id"`
+	ProviderSlug string     `json:"provider"`
+	ProviderName string     `json:"provider_name"`
+	Region       string     `json:"region"`
+	Type         string     `json:"type"`
+	Price        *float64   `json:"price"`
+	Currency     string     `json:"currency,omitempty"`
+	URL          string     `json:"url"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidTo      *time.Time `json:"valid_to"`
+}
+
+// Current 提供期間中であるか
+func (a *Availability) Current(now time.Time) bool {
+	return (a.ValidFrom == nil || !a.ValidFrom.After(now)) && (a.ValidTo == nil || a.ValidTo.After(now))
+}
+
+// 映画の外部ID（movie_external_ids.source）
+const (
+	ExternalSourceIMDb = "imdb"
+	ExternalSourceTMDb = "tmdb"
+)
+
+// FieldSource 外部から取り込んで書き込んだ項目の提供元と、書き込んだときの値
+// 現在の値と一致しない場合は、取り込み後に手動で編集されている
+type FieldSource struct {
+	Provider  string
+	Value     string
+	UpdatedAt time.Time
+}
+
+// 映画の画像の種類
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// MovieImage 映画に添付された画像とそのサムネイル
+// Key・ThumbnailKeyは画像を保存したストレージ上のキー
+type MovieImage struct {
+	ID           int       `json:"id"`
+	MovieID      int       `json:"-"`
+	Kind         string    `json:"kind"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Review ユーザーによる映画のレビュー
+type Review struct {
+	ID        int       `json:"id"`
+	MovieID   int       `json:"movie_id"`
+	UserID    int       `json:"user_id"`
+	Score     int       `json:"score"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReviewStats 映画のレビューの集計
+// Histogramは点数（1〜5）ごとの件数。LastModifiedは最後にレビューが書き込まれた日時
+type ReviewStats struct {
+	Average      float64     `json:"average"`
+	Count        int         `json:"count"`
+	Histogram    map[int]int `json:"histogram"`
+	LastModified time.Time   `json:"-"`
+}
+
+// Tag 映画に自由に付けられるタグ
+// MovieCountはタグが付いた映画（ゴミ箱にあるものを除く）の件数
+type Tag struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	MovieCount int       `json:"movie_count"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// Collection 編集部が作成する映画の特集（「スタッフのおすすめ」など）
+// Moviesは1件取得する場合のみ、特集内の順に設定する
+type Collection struct {
+	ID          int       `json:"id"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	MovieCount  int       `json:"movie_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Movies      []*Movie  `json:"movies,omitempty"`
+}
+
+// CatalogueStats カタログ全体の集計（ゴミ箱にある映画は含めない）
+// 平均上映時間は上映時間が設定された映画だけで計算する。Recentは作成・更新から7日・30日以内の映画の件数
+type CatalogueStats struct {
+	Totals         StatsTotals    `json:"totals"`
+	ByGenre        []*GenreCount  `json:"by_genre"`
+	ByDecade       []*DecadeCount `json:"by_decade"`
+	ByMPAARating   map[string]int `json:"by_mpaa_rating"`
+	AverageRuntime float64        `json:"average_runtime"`
+	AverageRating  float64        `json:"average_rating"`
+	Recent         RecentCounts   `json:"recent"`
+	GeneratedAt    time.Time      `json:"generated_at"`
+}
+
+// StatsTotals カタログの件数
+type StatsTotals struct {
+	Movies      int `json:"movies"`
+	Genres      int `json:"genres"`
+	People      int `json:"people"`
+	Reviews     int `json:"reviews"`
+	Tags        int `json:"tags"`
+	Collections int `json:"collections"`
+}
+
+// GenreCount ジャンルごとの映画の件数
+type GenreCount struct {
+	GenreID   int    `json:"genre_id"`
+	GenreName string `json:"genre_name"`
+	Movies    int    `json:"movies"`
+}
+
+// DecadeCount 公開年代（1990年代なら1990）ごとの映画の件数
+type DecadeCount struct {
+	Decade int `json:"decade"`
+	Movies int `json:"movies"`
+}
+
+// RecentCounts 最近作成・更新された映画の件数
+type RecentCounts struct {
+	AddedLast7Days    int `json:"added_last_7_days"`
+	AddedLast30Days   int `json:"added_last_30_days"`
+	UpdatedLast7Days  int `json:"updated_last_7_days"`
+	UpdatedLast30Days int `json:"updated_last_30_days"`
+}
+
+// Webhook 変更イベントを通知する送信先
+// EventTypesはイベントの種類か"genre.*"・"*"のようなワイルドカード。Secretは署名の鍵
+type Webhook struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Webhookの配信の状態
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery Webhookの配信キューの1件
+// URL・Secretは送信時のみ、Logは1件取得する場合のみ設定する
+type WebhookDelivery struct {
+	ID            int64                     `json:"id"`
+	WebhookID     int                       `json:"webhook_id"`
+	EventType     string                    `json:"event_type"`
+	Payload       json.RawMessage           `json:"payload"`
+	Status        string                    `json:"status"`
+	Attempts      int                       `json:"attempts"`
+	NextAttemptAt time.Time                 `json:"next_attempt_at"`
+	CreatedAt     time.Time                 `json:"created_at"`
+	UpdatedAt     time.Time                 `json:"updated_at"`
+	URL           string                    `json:"-"`
+	Secret        string                    `json:"-"`
+	Log           []*WebhookDeliveryAttempt `json:"log,omitempty"`
+}
+
+// WebhookDeliveryAttempt 配信ログ（送信1回の結果）
+// ResponseStatusは応答が無かった場合nil
+type WebhookDeliveryAttempt struct {
+	ID             int64     `json:"id"`
+	ResponseStatus *int      `json:"response_status"`
+	Error          string    `json:"error"`
+	DurationMS     int       `json:"duration_ms"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+}
+
+// WatchlistOrder ウォッチリストの並び順
+type WatchlistOrder string
+
+const (
+	WatchlistOrderPosition WatchlistOrder = "position"
+	WatchlistOrderAddedAt  WatchlistOrder = "added_at"
+	WatchlistOrderTitle    WatchlistOrder = "title"
+)
+
+// WatchlistItem ウォッチリストの1件
+type WatchlistItem struct {
+	MovieID   int       `json:"movie_id"`
+	Position  int       `json:"position"`
+	Note      string    `json:"note"`
+	AddedAt   time.Time `json:"added_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Movie     *Movie    `json:"movie"`
+}
+
+// WatchEvent 視聴履歴の1件
+type WatchEvent struct {
+	ID        int       `json:"id"`
+	MovieID   int       `json:"movie_id"`
+	WatchedAt time.Time `json:"watched_at"`
+	Note      string    `json:"note"`
+	Movie     *Movie    `json:"movie"`
+}
+
 type User struct {
 	ID       int
 	Email    string
 	Password string
 }
+
+// MovieOrderField 映画一覧の並び替えに利用できるカラム
+type MovieOrderField string
+
+const (
+	MovieOrderID          MovieOrderField = "id"
+	MovieOrderTitle       MovieOrderField = "title"
+	MovieOrderReleaseDate MovieOrderField = "release_date"
+	MovieOrderRating      MovieOrderField = "rating"
+	MovieOrderRuntime     MovieOrderField = "runtime"
+)
+
+// MovieFilter 映画一覧の絞り込み条件（ゼロ値の項目は条件に含めない）
+// Tagsを指定した場合は全てのタグが付いた映画に絞り込む
+// Providersを指定した場合はいずれかで現在視聴できる映画に絞り込み、Regionがあればその国の配信に限る
+type MovieFilter struct {
+	TitleContains string
+	GenreID       int
+	Year          int
+	MinRating     int
+	MPAARating    string
+	Tags          []string
+	Providers     []string
+	Region        string
+}
+
+// MovieKey キーセットページネーションの境界となる行（並び替えカラムの値とID）
+type MovieKey struct {
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// MoviePageArgs 映画一覧のページ取得条件
+// Firstが指定された場合はAfterより後ろを、Lastが指定された場合はBeforeより前を取得する
+type MoviePageArgs struct {
+	First   int
+	After   *MovieKey
+	Last    int
+	Before  *MovieKey
+	OrderBy MovieOrderField
+	Desc    bool
+	Filter  MovieFilter
+}
+
+// MoviePage 映画一覧の1ページ分の結果
+type MoviePage struct {
+	Movies          []*Movie
+	HasNextPage     bool
+	HasPreviousPage bool
+}
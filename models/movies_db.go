@@ -3,26 +3,52 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type DBModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache Cache
+	// tx Txの中で読み書きに使うトランザクション
+	tx *sql.Tx
 }
 
-// GetMovie 1つのMovieインスタンスを返す
-func (m *DBModel) GetMovie(id int) (*Movie, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// キャッシュのキー
+const (
+	cacheKeyMovie  = "movie:"
+	cacheKeyMovies = "movies"
+	cacheKeyGenres = "genres"
+	// cacheKeyStats 映画の書き込みで破棄されるよう、映画一覧と同じ接頭辞にする
+	cacheKeyStats = cacheKeyMovies + ":stats"
+)
 
-	query := `SELECT id, title, description, year, release_date, runtime, rating, mpaa_rating, created_at, updated_at 
-				FROM movies WHERE id = $1
-				`
-	row := m.DB.QueryRowContext(ctx, query, id)
+// ErrEditConflict 更新・削除対象のバージョンが指定されたものと異なる
+var ErrEditConflict = errors.New("edit conflict: the movie has been modified by someone else")
 
-	var movie Movie
-	err := row.Scan(
+// movieColumns scanMovieで読み込むmoviesのカラム
+const movieColumns = `id, title, description, year, release_date, runtime, rating, mpaa_rating, version, created_at, updated_at, deleted_at`
+
+// dbtx sql.DB・sql.Txに共通するクエリの実行
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanner sql.Row・sql.Rowsに共通するScan
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMovie movieColumnsの順に1行をmovieに読み込む
+// movieColumnsの後に続く列がある場合はextraに読み込む
+func scanMovie(row scanner, movie *Movie, extra ...interface{}) error {
+	dest := []interface{}{
 		&movie.ID,
 		&movie.Title,
 		&movie.Description,
@@ -31,9 +57,41 @@ func (m *DBModel) GetMovie(id int) (*Movie, error) {
 		&movie.Runtime,
 		&movie.Rating,
 		&movie.MPAARating,
+		&movie.Version,
 		&movie.CreatedAt,
 		&movie.UpdatedAt,
-	)
+		&movie.DeletedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// GetMovie 1つのMovieインスタンスを返す
+func (m *DBModel) GetMovie(id int) (*Movie, error) {
+	key := movieCacheKey(id)
+	if v, ok := m.Cache.Get(key); ok {
+		return v.(*Movie), nil
+	}
+
+	movie, err := m.getMovie(id)
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.Set(key, movie)
+
+	return movie, nil
+}
+
+func (m *DBModel) getMovie(id int) (*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + movieColumns + `
+				FROM movies WHERE id = $1 AND deleted_at IS NULL
+				`
+	row := m.conn().QueryRowContext(ctx, query, id)
+
+	var movie Movie
+	err := scanMovie(row, &movie)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +103,7 @@ func (m *DBModel) GetMovie(id int) (*Movie, error) {
 				INNER JOIN genres g ON (g.id = mg.genre_id)
 				WHERE mg.movie_id = $1
 			`
-	rows, _ := m.DB.QueryContext(ctx, query, id)
+	rows, _ := m.conn().QueryContext(ctx, query, id)
 
 	defer rows.Close()
 	for rows.Next() {
@@ -58,6 +116,43 @@ func (m *DBModel) GetMovie(id int) (*Movie, error) {
 	}
 	movie.MovieGenre = mgs
 
+	movie.Credits, err = m.getMovieCredits(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.ReviewStats, err = m.getReviewStats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.Images, err = m.getMovieImages(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.Translations, err = m.getMovieTranslations(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.Tags, err = m.getMovieTags(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.ExternalIDs, err = m.getMovieExternalIDs(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.Releases, err = m.getMovieReleases(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.Availability, err = m.getMovieAvailability(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	movie.RelatedModified, err = m.getMovieRelatedModified(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	return &movie, nil
 }
 
@@ -65,18 +160,36 @@ func (m *DBModel) GetMovie(id int) (*Movie, error) {
 //	引数に受け取ったgenreに属するMovieインスタンスを返す
 // INFO: 引数のgenreをスライスにしているのは、オプショナルにするため
 func (m *DBModel) GetAllMovies(genre ...int) ([]*Movie, error) {
+	key := cacheKeyMovies
+	if len(genre) > 0 {
+		key = fmt.Sprintf("%s:genre:%d", cacheKeyMovies, genre[0])
+	}
+	if v, ok := m.Cache.Get(key); ok {
+		return v.([]*Movie), nil
+	}
+
+	movies, err := m.getAllMovies(genre...)
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.Set(key, movies)
+
+	return movies, nil
+}
+
+func (m *DBModel) getAllMovies(genre ...int) ([]*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var where string
+	where := `WHERE deleted_at IS NULL`
 	if len(genre) > 0 {
-		where = fmt.Sprintf(`WHERE id IN (SELECT movie_id from movies_genres WHERE genre_id = %d)`, genre[0])
+		where += fmt.Sprintf(` AND id IN (SELECT movie_id from movies_genres WHERE genre_id = %d)`, genre[0])
 	}
 
-	query := fmt.Sprintf(`SELECT id, title, description, year, release_date, runtime, rating, mpaa_rating, created_at, updated_at 
-				FROM movies %s`, where)
+	query := fmt.Sprintf(`SELECT %s
+				FROM movies %s`, movieColumns, where)
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.conn().QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -84,17 +197,7 @@ func (m *DBModel) GetAllMovies(genre ...int) ([]*Movie, error) {
 	var movies []*Movie
 	for rows.Next() {
 		var movie Movie
-		err := rows.Scan(&movie.ID,
-			&movie.Title,
-			&movie.Description,
-			&movie.Year,
-			&movie.ReleaseDate,
-			&movie.Runtime,
-			&movie.Rating,
-			&movie.MPAARating,
-			&movie.CreatedAt,
-			&movie.UpdatedAt,
-		)
+		err := scanMovie(rows, &movie)
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +208,7 @@ func (m *DBModel) GetAllMovies(genre ...int) ([]*Movie, error) {
 				INNER JOIN genres g ON (g.id = mg.genre_id)
 				WHERE mg.movie_id = $1
 			`
-		genreRows, _ := m.DB.QueryContext(ctx, genreQuery, movie.ID)
+		genreRows, _ := m.conn().QueryContext(ctx, genreQuery, movie.ID)
 
 		for genreRows.Next() {
 			var mg MovieGenre
@@ -119,17 +222,71 @@ func (m *DBModel) GetAllMovies(genre ...int) ([]*Movie, error) {
 		movie.MovieGenre = mgs
 		movies = append(movies, &movie)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		movie.Credits, err = m.getMovieCredits(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.ReviewStats, err = m.getReviewStats(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Images, err = m.getMovieImages(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Translations, err = m.getMovieTranslations(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Tags, err = m.getMovieTags(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.ExternalIDs, err = m.getMovieExternalIDs(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Releases, err = m.getMovieReleases(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Availability, err = m.getMovieAvailability(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.RelatedModified, err = m.getMovieRelatedModified(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return movies, nil
 }
 
-func (m *DBModel) InsertMovie(movie Movie) error {
+// InsertMovie Movieを新規作成し、採番されたIDを返す
+func (m *DBModel) InsertMovie(movie Movie) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	id, err := insertMovie(ctx, m.conn(), movie)
+	if err != nil {
+		return 0, err
+	}
+	m.invalidateMovie(id)
+
+	return id, nil
+}
+
+func insertMovie(ctx context.Context, db dbtx, movie Movie) (int, error) {
 	query := `INSERT INTO movies (title, description, year, release_date, runtime, rating, mpaa_rating,
-				created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err := m.DB.ExecContext(ctx, query,
+				created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	var id int
+	err := db.QueryRowContext(ctx, query,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -139,23 +296,52 @@ func (m *DBModel) InsertMovie(movie Movie) error {
 		movie.MPAARating,
 		movie.CreatedAt,
 		movie.UpdatedAt,
-	)
+	).Scan(&id)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return id, nil
 }
 
+// UpdateMovie Movieを更新し、バージョンを1つ進める
+// 更新前の状態は同じトランザクションでmovie_revisionsに保存する
+// movie.Versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
 func (m *DBModel) UpdateMovie(movie Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateMovie(ctx, tx, movie); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movie.ID)
+
+	return nil
+}
+
+// updateMovie トランザクション内でUpdateMovieの更新を行う
+func updateMovie(ctx context.Context, tx dbtx, movie Movie) error {
+	if err := snapshotMovie(ctx, tx, movie.ID, movie.Version, movie.UpdatedAt); err != nil {
+		return err
+	}
+
 	query := `UPDATE movies SET title = $1, description = $2, year = $3, release_date = $4, runtime = $5, 
-                  rating = $6, mpaa_rating = $7, updated_at = $8 WHERE id = $9`
+                  rating = $6, mpaa_rating = $7, updated_at = $8, version = version + 1
+                  WHERE id = $9`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	_, err := tx.ExecContext(ctx, query,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -167,23 +353,380 @@ func (m *DBModel) UpdateMovie(movie Movie) error {
 		movie.ID,
 	)
 
+	return err
+}
+
+// snapshotMovie バージョンを進める前に、現在の状態をmovie_revisionsに保存する
+// versionが0でない場合は保存されているバージョンと一致するときだけ保存し、
+// 一致しなければErrEditConflictを返す
+func snapshotMovie(ctx context.Context, tx dbtx, id, version int, revisedAt time.Time) error {
+	// 同時に更新されないよう行ロックを取得してからバージョンを確認する
+	var current int
+	err := tx.QueryRowContext(ctx, `SELECT version FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&current)
 	if err != nil {
 		return err
 	}
+	if version != 0 && version != current {
+		return ErrEditConflict
+	}
+
+	return insertRevision(ctx, tx, id, revisedAt)
+}
+
+// insertRevision 映画の現在の状態をmovie_revisionsに保存する。行ロックは呼び出し側で取得しておく
+func insertRevision(ctx context.Context, tx dbtx, id int, revisedAt time.Time) error {
+	query := `INSERT INTO movie_revisions (movie_id, version, title, description, year, release_date, runtime,
+				rating, mpaa_rating, revised_at)
+				SELECT id, version, title, description, year, release_date, runtime, rating, mpaa_rating, $2
+				FROM movies WHERE id = $1`
+	_, err := tx.ExecContext(ctx, query, id, revisedAt)
+
+	return err
+}
+
+// reviseMovies subqueryで選んだ映画（ゴミ箱にあるものを除く）ごとに現在の状態をmovie_revisionsに保存し、バージョンを1つ進める
+// タグや配信サービスのように複数の映画に埋め込まれるデータを変更した場合に、映画のETagと一覧の検証子を変えるために使う
+func reviseMovies(ctx context.Context, tx dbtx, now time.Time, subquery string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM movies WHERE deleted_at IS NULL AND id IN (`+subquery+`) ORDER BY id`, args...)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := snapshotMovie(ctx, tx, id, 0, now); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, id)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (m *DBModel) DeleteMovie(id int) error {
+// DeleteMovie Movieをゴミ箱に移す（論理削除）
+// 削除前の状態は同じトランザクションでmovie_revisionsに保存する
+// versionが0でない場合は保存されているバージョンと一致するときだけ削除する
+func (m *DBModel) DeleteMovie(id, version int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM movies WHERE id = $1`
-	_, err := m.DB.QueryContext(ctx, query, id)
-
+	tx, err := m.begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, id, version, now); err != nil {
+		return err
+	}
+
+	query := `UPDATE movies SET deleted_at = $1, updated_at = $1, version = version + 1 WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, query, now, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(id)
 
 	return nil
 }
+
+// invalidateMovie 映画の書き込み後に詳細と全ての一覧のキャッシュを破棄する
+func (m *DBModel) invalidateMovie(id int) {
+	m.Cache.DeletePrefix(movieCacheKey(id))
+	m.Cache.DeletePrefix(cacheKeyMovies)
+}
+
+// movieCacheKey 映画の詳細のキャッシュのキー
+// 接頭辞で破棄したときに他の映画（id 1に対する10など）を巻き込まないよう、IDの後に区切りを付ける
+func movieCacheKey(id int) string {
+	return cacheKeyMovie + strconv.Itoa(id) + ":"
+}
+
+// InvalidateGenres ジャンルの書き込み後にジャンルと、ジャンル名を含む映画・映画一覧・集計のキャッシュを破棄する
+func (m *DBModel) InvalidateGenres() {
+	m.Cache.DeletePrefix(cacheKeyGenres)
+	m.Cache.DeletePrefix(cacheKeyMovie)
+	m.Cache.DeletePrefix(cacheKeyMovies)
+}
+
+// MoviesValidator 映画一覧（ジャンル・クレジットの人物・レビューを含む）の件数と最終更新日時を返す
+// 配信は提供期間の開始・終了で表示が変わるため、過ぎた境界のうち最も新しいものも最終更新日時に含める
+func (m *DBModel) MoviesValidator() (*Validator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT
+				(SELECT count(*) FROM movies WHERE deleted_at IS NULL) + (SELECT count(*) FROM movies_genres)
+					+ (SELECT count(*) FROM reviews) + (SELECT count(*) FROM tags) + (SELECT count(*) FROM providers)
+					+ (SELECT count(*) FROM genres) + (SELECT count(*) FROM people) + (SELECT count(*) FROM movie_credits),
+				GREATEST(
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM movies),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM movies_genres),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM genres),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM people),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM reviews),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM tags),
+					(SELECT COALESCE(max(updated_at), 'epoch') FROM providers),
+					(SELECT COALESCE(max(b), 'epoch') FROM (
+						SELECT valid_from AS b FROM movie_availability UNION ALL SELECT valid_to FROM movie_availability
+					) boundaries WHERE b <= now())::timestamp
+				)`
+
+	var v Validator
+	err := m.conn().QueryRowContext(ctx, query).Scan(&v.Count, &v.LastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// conditions 絞り込み条件をWHERE句の条件とプレースホルダーの値にする
+// ゴミ箱にある映画は常に除外する
+func (f MovieFilter) conditions() ([]string, []interface{}) {
+	conds := []string{"deleted_at IS NULL"}
+	var params []interface{}
+	addCond := func(format string, v interface{}) {
+		params = append(params, v)
+		conds = append(conds, fmt.Sprintf(format, len(params)))
+	}
+
+	if f.TitleContains != "" {
+		addCond("title ILIKE '%%' || $%d || '%%'", f.TitleContains)
+	}
+	if f.GenreID > 0 {
+		addCond("id IN (SELECT movie_id FROM movies_genres WHERE genre_id = $%d)", f.GenreID)
+	}
+	if f.Year > 0 {
+		addCond("year = $%d", f.Year)
+	}
+	if f.MinRating > 0 {
+		addCond("rating >= $%d", f.MinRating)
+	}
+	if f.MPAARating != "" {
+		addCond("mpaa_rating = $%d", f.MPAARating)
+	}
+	for _, tag := range f.Tags {
+		addCond("id IN (SELECT mt.movie_id FROM movie_tags mt INNER JOIN tags t ON (t.id = mt.tag_id) WHERE t.name = $%d)", tag)
+	}
+	if len(f.Providers) > 0 {
+		current := `SELECT a.movie_id FROM movie_availability a INNER JOIN providers p ON (p.id = a.provider_id)
+				WHERE p.slug = ANY($%d) AND (a.valid_from IS NULL OR a.valid_from <= now()) AND (a.valid_to IS NULL OR a.valid_to > now())`
+		if f.Region != "" {
+			params = append(params, f.Region)
+			current += fmt.Sprintf(" AND a.region = $%d", len(params))
+		}
+		addCond("id IN ("+current+")", pq.Array(f.Providers))
+	}
+
+	return conds, params
+}
+
+// KeyOf 並び替えカラムorderにおけるmovieのキーセットの境界値を返す
+func KeyOf(movie *Movie, order MovieOrderField) MovieKey {
+	key := MovieKey{ID: movie.ID}
+	switch order {
+	case MovieOrderTitle:
+		key.Value = movie.Title
+	case MovieOrderReleaseDate:
+		key.Value = movie.ReleaseDate.Format("2006-01-02")
+	case MovieOrderRating:
+		key.Value = strconv.Itoa(movie.Rating)
+	case MovieOrderRuntime:
+		key.Value = strconv.Itoa(movie.Runtime)
+	default:
+		key.Value = strconv.Itoa(movie.ID)
+	}
+	return key
+}
+
+// GetMoviesPage キーセットページネーションで映画一覧の1ページを返す
+// (並び替えカラム, id)の組で境界を比較するため、OFFSETと違い深いページでも速度が落ちない
+func (m *DBModel) GetMoviesPage(args MoviePageArgs) (*MoviePage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	order := args.OrderBy
+	switch order {
+	case MovieOrderID, MovieOrderTitle, MovieOrderReleaseDate, MovieOrderRating, MovieOrderRuntime:
+	default:
+		order = MovieOrderID
+	}
+
+	conds, params := args.Filter.conditions()
+
+	// 後ろから取得する場合は並び順を反転して取得し、最後に元の順序へ戻す
+	backward := args.Last > 0 && args.First == 0
+	desc := args.Desc != backward
+	limit := args.First
+	key := args.After
+	if backward {
+		limit = args.Last
+		key = args.Before
+	}
+
+	if key != nil {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		params = append(params, key.Value, key.ID)
+		conds = append(conds, fmt.Sprintf("(%s, id) %s ($%d, $%d)", order, op, len(params)-1, len(params)))
+	}
+
+	where := "WHERE " + strings.Join(conds, " AND ")
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	var limitClause string
+	if limit > 0 {
+		// 次のページの有無を判定するため1件多く取得する
+		params = append(params, limit+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(params))
+	}
+
+	query := fmt.Sprintf(`SELECT %s
+				FROM movies %s ORDER BY %s %s, id %s %s`, movieColumns, where, order, direction, direction, limitClause)
+
+	rows, err := m.conn().QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+	for rows.Next() {
+		var movie Movie
+		err := scanMovie(rows, &movie)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &MoviePage{}
+	hasMore := limit > 0 && len(movies) > limit
+	if hasMore {
+		movies = movies[:limit]
+	}
+	if backward {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+		page.HasPreviousPage = hasMore
+		page.HasNextPage = args.Before != nil
+	} else {
+		page.HasNextPage = hasMore
+		page.HasPreviousPage = args.After != nil
+	}
+
+	for _, movie := range movies {
+		movie.MovieGenre, err = m.getMovieGenres(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Credits, err = m.getMovieCredits(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.ReviewStats, err = m.getReviewStats(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Images, err = m.getMovieImages(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Translations, err = m.getMovieTranslations(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Tags, err = m.getMovieTags(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.ExternalIDs, err = m.getMovieExternalIDs(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Releases, err = m.getMovieReleases(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.Availability, err = m.getMovieAvailability(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+		movie.RelatedModified, err = m.getMovieRelatedModified(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	page.Movies = movies
+
+	return page, nil
+}
+
+// getMovieRelatedModified 映画のクレジットの人物とジャンルのうち最も新しい更新日時を返す
+func (m *DBModel) getMovieRelatedModified(ctx context.Context, movieID int) (time.Time, error) {
+	query := `SELECT GREATEST(
+					(SELECT COALESCE(max(p.updated_at), 'epoch') FROM movie_credits c
+						INNER JOIN people p ON (p.id = c.person_id) WHERE c.movie_id = $1),
+					(SELECT COALESCE(max(g.updated_at), 'epoch') FROM movies_genres mg
+						INNER JOIN genres g ON (g.id = mg.genre_id) WHERE mg.movie_id = $1)
+				)`
+	var t time.Time
+	err := m.conn().QueryRowContext(ctx, query, movieID).Scan(&t)
+	return t, err
+}
+
+// getMovieGenres 映画に紐づくジャンルをmovies_genresのIDをキーにしたmapで返す
+func (m *DBModel) getMovieGenres(ctx context.Context, movieID int) (map[int]string, error) {
+	query := `SELECT mg.id, mg.movie_id, mg.genre_id, g.genre_name
+				FROM movies_genres mg
+				INNER JOIN genres g ON (g.id = mg.genre_id)
+				WHERE mg.movie_id = $1
+			`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mgs := make(map[int]string)
+	for rows.Next() {
+		var mg MovieGenre
+		err := rows.Scan(&mg.ID, &mg.MovieID, &mg.GenreID, &mg.Genre.GenreName)
+		if err != nil {
+			return nil, err
+		}
+		mgs[mg.ID] = mg.Genre.GenreName
+	}
+
+	return mgs, rows.Err()
+}
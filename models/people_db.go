@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const personColumns = `id, name, biography, birth_date, created_at, updated_at`
+
+func scanPerson(row scanner, p *Person) error {
+	return row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Biography,
+		&p.BirthDate,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+}
+
+// GetPeople 名前にnameContainsを含む人物を名前順に返す（空の場合は全件）
+func (m *DBModel) GetPeople(nameContains string) ([]*Person, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + personColumns + ` FROM people
+				WHERE $1 = '' OR name ILIKE '%' || $1 || '%'
+				ORDER BY name, id`
+	rows, err := m.conn().QueryContext(ctx, query, nameContains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var people []*Person
+	for rows.Next() {
+		var p Person
+		if err := scanPerson(rows, &p); err != nil {
+			return nil, err
+		}
+		people = append(people, &p)
+	}
+
+	return people, rows.Err()
+}
+
+// GetPerson 1人の人物を、関わった映画（ゴミ箱にあるものを除く）と合わせて返す
+func (m *DBModel) GetPerson(id int) (*Person, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p Person
+	row := m.conn().QueryRowContext(ctx, `SELECT `+personColumns+` FROM people WHERE id = $1`, id)
+	if err := scanPerson(row, &p); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT m.id, m.title, m.year, c.role, c.character_name
+				FROM movie_credits c
+				INNER JOIN movies m ON (m.id = c.movie_id)
+				WHERE c.person_id = $1 AND m.deleted_at IS NULL
+				ORDER BY m.release_date DESC, m.id, c.billing_order`
+	rows, err := m.conn().QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p.Filmography = []*FilmographyEntry{}
+	for rows.Next() {
+		var e FilmographyEntry
+		if err := rows.Scan(&e.MovieID, &e.Title, &e.Year, &e.Role, &e.Character); err != nil {
+			return nil, err
+		}
+		p.Filmography = append(p.Filmography, &e)
+	}
+
+	return &p, rows.Err()
+}
+
+// InsertPerson 人物を新規作成し、採番されたIDを返す
+// 人物の件数は集計に含まれるため、集計のキャッシュを破棄する
+func (m *DBModel) InsertPerson(p Person) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO people (name, biography, birth_date, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, p.Name, p.Biography, p.BirthDate, p.CreatedAt, p.UpdatedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	m.Cache.DeletePrefix(cacheKeyStats)
+
+	return id, nil
+}
+
+// UpdatePerson 人物を更新する。存在しない場合はsql.ErrNoRowsを返す
+// 人物名はクレジットとして映画に含まれるため、映画のキャッシュも破棄する
+func (m *DBModel) UpdatePerson(p Person) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE people SET name = $1, biography = $2, birth_date = $3, updated_at = $4 WHERE id = $5`
+	result, err := m.conn().ExecContext(ctx, query, p.Name, p.Biography, p.BirthDate, p.UpdatedAt, p.ID)
+	if err != nil {
+		return err
+	}
+	m.invalidatePeople()
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// DeletePerson 人物とそのクレジットを削除する。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeletePerson(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	m.invalidatePeople()
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// SetMovieCredits 映画のクレジットをcreditsで置き換え、映画のバージョンを1つ進める
+// versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) SetMovieCredits(movieID, version int, credits []Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_credits (movie_id, person_id, role, character_name, billing_order, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`
+	for _, c := range credits {
+		if _, err := tx.ExecContext(ctx, query, movieID, c.PersonID, c.Role, c.Character, c.Order, now); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// getMovieCredits 映画のクレジットを表示順に返す
+func (m *DBModel) getMovieCredits(ctx context.Context, movieID int) ([]*Credit, error) {
+	query := `SELECT c.id, c.movie_id, c.person_id, p.name, c.role, c.character_name, c.billing_order
+				FROM movie_credits c
+				INNER JOIN people p ON (p.id = c.person_id)
+				WHERE c.movie_id = $1
+				ORDER BY c.billing_order, c.id`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var c Credit
+		err := rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.PersonName, &c.Role, &c.Character, &c.Order)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+
+	return credits, rows.Err()
+}
+
+// invalidatePeople 人物の書き込み後に、クレジットを含む映画のキャッシュを破棄する
+func (m *DBModel) invalidatePeople() {
+	m.Cache.DeletePrefix(cacheKeyMovie)
+	m.Cache.DeletePrefix(cacheKeyMovies)
+}
+
+// rowsAffectedOrNoRows 更新・削除の件数が0件の場合にsql.ErrNoRowsを返す
+func rowsAffectedOrNoRows(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
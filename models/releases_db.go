@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// SetMovieReleases 映画の国ごとの公開をreleasesで置き換え、映画のバージョンを1つ進める
+// versionが0でない場合は保存されているバージョンと一致するときだけ更新し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) SetMovieReleases(movieID, version int, releases []Release) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movie_releases WHERE movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_releases (movie_id, country, release_type, release_date, certification, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`
+	for _, r := range releases {
+		if _, err := tx.ExecContext(ctx, query, movieID, r.Country, r.Type, r.Date, r.Certification, now); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// getMovieReleases 映画の国ごとの公開を国コード、公開日の順に返す
+func (m *DBModel) getMovieReleases(ctx context.Context, movieID int) ([]*Release, error) {
+	query := `SELECT id, movie_id, country, release_type, release_date, certification
+				FROM movie_releases WHERE movie_id = $1
+				ORDER BY country, release_date, release_type DESC`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []*Release{}
+	for rows.Next() {
+		var r Release
+		if err := rows.Scan(&r.ID, &r.MovieID, &r.Country, &r.Type, &r.Date, &r.Certification); err != nil {
+			return nil, err
+		}
+		releases = append(releases, &r)
+	}
+
+	return releases, rows.Err()
+}
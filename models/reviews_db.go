@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrDuplicateReview ユーザーが既にその映画をレビューしている
+var ErrDuplicateReview = errors.New("you have already reviewed this movie")
+
+const reviewColumns = `id, movie_id, user_id, score, body, created_at, updated_at`
+
+func scanReview(row scanner, r *Review) error {
+	return row.Scan(
+		&r.ID,
+		&r.MovieID,
+		&r.UserID,
+		&r.Score,
+		&r.Body,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+}
+
+// GetReviews 映画のレビューを新しい順にoffset件目からlimit件返す
+// 2つ目の戻り値はレビューの総数
+func (m *DBModel) GetReviews(movieID, limit, offset int) ([]*Review, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.conn().QueryRowContext(ctx, `SELECT count(*) FROM reviews WHERE movie_id = $1`, movieID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + reviewColumns + ` FROM reviews WHERE movie_id = $1
+				ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`
+	rows, err := m.conn().QueryContext(ctx, query, movieID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		var r Review
+		if err := scanReview(rows, &r); err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, &r)
+	}
+
+	return reviews, total, rows.Err()
+}
+
+// GetReview 1件のレビューを返す
+func (m *DBModel) GetReview(id int) (*Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var r Review
+	row := m.conn().QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM reviews WHERE id = $1`, id)
+	if err := scanReview(row, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// InsertReview レビューを作成し、採番されたIDを返す
+// 同じユーザーのレビューが既にある場合はErrDuplicateReviewを返す
+func (m *DBModel) InsertReview(r Review) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO reviews (movie_id, user_id, score, body, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (movie_id, user_id) DO NOTHING RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, r.MovieID, r.UserID, r.Score, r.Body, r.CreatedAt, r.UpdatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrDuplicateReview
+	}
+	if err != nil {
+		return 0, err
+	}
+	m.invalidateMovie(r.MovieID)
+
+	return id, nil
+}
+
+// UpdateReview レビューの点数と本文を更新する。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) UpdateReview(r Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE reviews SET score = $1, body = $2, updated_at = $3 WHERE id = $4`
+	result, err := m.conn().ExecContext(ctx, query, r.Score, r.Body, r.UpdatedAt, r.ID)
+	if err != nil {
+		return err
+	}
+	m.invalidateMovie(r.MovieID)
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// DeleteReview レビューを削除する。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteReview(r Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM reviews WHERE id = $1`, r.ID)
+	if err != nil {
+		return err
+	}
+	m.invalidateMovie(r.MovieID)
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// getReviewStats 映画のレビューの平均点（小数第2位まで）・件数・点数ごとの件数を返す
+func (m *DBModel) getReviewStats(ctx context.Context, movieID int) (*ReviewStats, error) {
+	query := `SELECT score, count(*), max(updated_at) FROM reviews WHERE movie_id = $1 GROUP BY score`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &ReviewStats{Histogram: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	sum := 0
+	for rows.Next() {
+		var score, n int
+		var lastModified time.Time
+		if err := rows.Scan(&score, &n, &lastModified); err != nil {
+			return nil, err
+		}
+		stats.Histogram[score] = n
+		stats.Count += n
+		sum += score * n
+		if lastModified.After(stats.LastModified) {
+			stats.LastModified = lastModified
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if stats.Count > 0 {
+		stats.Average = math.Round(float64(sum)/float64(stats.Count)*100) / 100
+	}
+
+	return stats, nil
+}
+
+// CoReviewerCounts 映画をレビューしたユーザーが他にレビューした映画ごとに、そのユーザー数を返す
+// ゴミ箱にある映画は含めない
+func (m *DBModel) CoReviewerCounts(movieID int) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT o.movie_id, count(*) FROM reviews r
+				INNER JOIN reviews o ON (o.user_id = r.user_id AND o.movie_id <> r.movie_id)
+				INNER JOIN movies mv ON (mv.id = o.movie_id)
+				WHERE r.movie_id = $1 AND mv.deleted_at IS NULL
+				GROUP BY o.movie_id`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+
+	return counts, rows.Err()
+}
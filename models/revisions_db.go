@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// MovieRevision ある時点のMovieの状態
+// VersionはそのときのMovieのバージョン、RevisedAtは次のバージョンに更新された日時（現在の状態ではnil）
+type MovieRevision struct {
+	MovieID     int        `json:"movie_id"`
+	Version     int        `json:"version"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Year        int        `json:"year"`
+	ReleaseDate time.Time  `json:"release_date"`
+	Runtime     int        `json:"runtime"`
+	Rating      int        `json:"rating"`
+	MPAARating  string     `json:"mpaa_rating"`
+	RevisedAt   *time.Time `json:"revised_at"`
+}
+
+const revisionColumns = `movie_id, version, title, description, year, release_date, runtime, rating, mpaa_rating, revised_at`
+
+func scanRevision(row scanner, r *MovieRevision) error {
+	return row.Scan(
+		&r.MovieID,
+		&r.Version,
+		&r.Title,
+		&r.Description,
+		&r.Year,
+		&r.ReleaseDate,
+		&r.Runtime,
+		&r.Rating,
+		&r.MPAARating,
+		&r.RevisedAt,
+	)
+}
+
+// GetMovieRevisions Movieの過去の状態を新しい順に返す
+func (m *DBModel) GetMovieRevisions(movieID int) ([]*MovieRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + revisionColumns + ` FROM movie_revisions WHERE movie_id = $1 ORDER BY version DESC`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*MovieRevision
+	for rows.Next() {
+		var r MovieRevision
+		if err := scanRevision(rows, &r); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetMovieRevision Movieの指定したバージョンの状態を返す
+// versionが現在のバージョンの場合は現在の状態を返し、どちらにも無い場合はsql.ErrNoRowsを返す
+func (m *DBModel) GetMovieRevision(movieID, version int) (*MovieRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + revisionColumns + ` FROM movie_revisions WHERE movie_id = $1 AND version = $2
+				UNION ALL
+				SELECT id, version, title, description, year, release_date, runtime, rating, mpaa_rating, NULL
+				FROM movies WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+				LIMIT 1`
+
+	var r MovieRevision
+	err := scanRevision(m.conn().QueryRowContext(ctx, query, movieID, version), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// DiffRevisions 2つの状態の間で変更されたフィールドを返す
+func DiffRevisions(from, to *MovieRevision) (json.RawMessage, error) {
+	// 状態の識別に使うフィールドは比較しない
+	a, b := *from, *to
+	a.Version, b.Version = 0, 0
+	a.RevisedAt, b.RevisedAt = nil, nil
+
+	before, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffJSON(before, after)
+}
+
+// RollbackMovie Movieを指定したバージョンの状態に戻し、変更した場合はtrueを返す
+// 戻す操作も通常の更新として扱うため、現在の状態は新しい履歴として保存される
+// versionが現在のバージョンの場合は何も変更せずにfalseを返す。expectedVersionの扱いはUpdateMovieと同じ
+func (m *DBModel) RollbackMovie(movieID, version, expectedVersion int) (bool, error) {
+	r, err := m.GetMovieRevision(movieID, version)
+	if err != nil {
+		return false, err
+	}
+	if r.RevisedAt == nil {
+		if expectedVersion != 0 && expectedVersion != r.Version {
+			return false, ErrEditConflict
+		}
+		return false, nil
+	}
+
+	err = m.UpdateMovie(Movie{
+		ID:          movieID,
+		Title:       r.Title,
+		Description: r.Description,
+		Year:        r.Year,
+		ReleaseDate: r.ReleaseDate,
+		Runtime:     r.Runtime,
+		Rating:      r.Rating,
+		MPAARating:  r.MPAARating,
+		Version:     expectedVersion,
+		UpdatedAt:   time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRollbackMovieToCurrentVersion 現在のバージョンに戻す場合は何も書き込まずにfalseを返すこと
+func TestRollbackMovieToCurrentVersion(t *testing.T) {
+	fake := &fakeDB{row: func(query string) []driver.Value {
+		// GetMovieRevisionが現在の状態（revised_atがNULL）を返す
+		return []driver.Value{int64(1), int64(3), "Heat", "", int64(1995), time.Date(1995, 12, 15, 0, 0, 0, 0, time.UTC), int64(170), int64(5), "R", nil}
+	}}
+	m := &DBModel{DB: sql.OpenDB(fake), Cache: NewNoCache()}
+	defer m.DB.Close()
+
+	changed, err := m.RollbackMovie(1, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("RollbackMovie reported a change when rolling back to the current version")
+	}
+	for _, query := range fake.committed {
+		if !strings.HasPrefix(strings.TrimSpace(query), "SELECT") {
+			t.Errorf("unexpected write: %s", query)
+		}
+	}
+
+	// If-Matchのバージョンが古い場合は変更が無くても競合にする
+	if _, err := m.RollbackMovie(1, 3, 2); err != ErrEditConflict {
+		t.Errorf("err = %v, want %v", err, ErrEditConflict)
+	}
+}
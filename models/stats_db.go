@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// GetStats カタログ全体の集計を返す
+// 映画・レビュー・ジャンル・人物・タグ・特集の書き込みでキャッシュを破棄する。最近の件数はキャッシュの有効期限まで古い場合がある
+func (m *DBModel) GetStats() (*CatalogueStats, error) {
+	if v, ok := m.Cache.Get(cacheKeyStats); ok {
+		return v.(*CatalogueStats), nil
+	}
+
+	stats, err := m.getStats()
+	if err != nil {
+		return nil, err
+	}
+	m.Cache.Set(cacheKeyStats, stats)
+
+	return stats, nil
+}
+
+func (m *DBModel) getStats() (*CatalogueStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	stats := &CatalogueStats{
+		ByGenre:      []*GenreCount{},
+		ByDecade:     []*DecadeCount{},
+		ByMPAARating: map[string]int{},
+		GeneratedAt:  now,
+	}
+
+	query := `SELECT
+				count(*),
+				COALESCE(round(avg(runtime) FILTER (WHERE runtime > 0), 2), 0),
+				COALESCE(round(avg(rating), 2), 0),
+				count(*) FILTER (WHERE created_at >= $1),
+				count(*) FILTER (WHERE created_at >= $2),
+				count(*) FILTER (WHERE updated_at >= $1),
+				count(*) FILTER (WHERE updated_at >= $2),
+				(SELECT count(*) FROM genres),
+				(SELECT count(*) FROM people),
+				(SELECT count(*) FROM reviews r INNER JOIN movies rm ON (rm.id = r.movie_id) WHERE rm.deleted_at IS NULL),
+				(SELECT count(*) FROM tags),
+				(SELECT count(*) FROM collections)
+				FROM movies WHERE deleted_at IS NULL`
+	err := m.conn().QueryRowContext(ctx, query, now.AddDate(0, 0, -7), now.AddDate(0, 0, -30)).Scan(
+		&stats.Totals.Movies,
+		&stats.AverageRuntime,
+		&stats.AverageRating,
+		&stats.Recent.AddedLast7Days,
+		&stats.Recent.AddedLast30Days,
+		&stats.Recent.UpdatedLast7Days,
+		&stats.Recent.UpdatedLast30Days,
+		&stats.Totals.Genres,
+		&stats.Totals.People,
+		&stats.Totals.Reviews,
+		&stats.Totals.Tags,
+		&stats.Totals.Collections,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// 映画の無いジャンルも0件として含める
+	query = `SELECT g.id, g.genre_name, count(m.id)
+				FROM genres g
+				LEFT JOIN movies_genres mg ON (mg.genre_id = g.id)
+				LEFT JOIN movies m ON (m.id = mg.movie_id AND m.deleted_at IS NULL)
+				GROUP BY g.id, g.genre_name
+				ORDER BY count(m.id) DESC, g.genre_name`
+	rows, err := m.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g GenreCount
+		if err := rows.Scan(&g.GenreID, &g.GenreName, &g.Movies); err != nil {
+			return nil, err
+		}
+		stats.ByGenre = append(stats.ByGenre, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT year / 10 * 10 AS decade, count(*)
+				FROM movies WHERE deleted_at IS NULL AND year > 0
+				GROUP BY decade ORDER BY decade`
+	rows, err = m.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DecadeCount
+		if err := rows.Scan(&d.Decade, &d.Movies); err != nil {
+			return nil, err
+		}
+		stats.ByDecade = append(stats.ByDecade, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = m.conn().QueryContext(ctx, `SELECT mpaa_rating, count(*) FROM movies WHERE deleted_at IS NULL GROUP BY mpaa_rating`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rating string
+		var n int
+		if err := rows.Scan(&rating, &n); err != nil {
+			return nil, err
+		}
+		stats.ByMPAARating[rating] = n
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// ErrDuplicateTag 同じ名前のタグが既にある
+var ErrDuplicateTag = errors.New("a tag with this name already exists: merge the tags instead")
+
+const tagColumns = `t.id, t.name, t.created_at, t.updated_at,
+				(SELECT count(*) FROM movie_tags mt
+					INNER JOIN movies m ON (m.id = mt.movie_id)
+					WHERE mt.tag_id = t.id AND m.deleted_at IS NULL) AS movie_count`
+
+func scanTag(row scanner, t *Tag) error {
+	return row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.MovieCount,
+	)
+}
+
+// SearchTags 名前にqueryを含むタグを最大limit件返す（queryが空の場合は全てのタグが対象）
+// 入力補完に使うため、queryで始まるタグ、映画の件数が多いタグ、名前の順に並べる
+func (m *DBModel) SearchTags(query string, limit int) ([]*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	q := `SELECT ` + tagColumns + ` FROM tags t
+				WHERE $1 = '' OR t.name ILIKE '%' || $1 || '%'
+				ORDER BY t.name ILIKE $1 || '%' DESC, movie_count DESC, t.name
+				LIMIT $2`
+	rows, err := m.conn().QueryContext(ctx, q, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := scanTag(rows, &t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &t)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetTag タグを1件返す
+func (m *DBModel) GetTag(id int) (*Tag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t Tag
+	row := m.conn().QueryRowContext(ctx, `SELECT `+tagColumns+` FROM tags t WHERE t.id = $1`, id)
+	if err := scanTag(row, &t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// SetMovieTags 映画のタグをnamesで置き換え、映画のバージョンを1つ進める
+// 存在しないタグは作成する。versionが0でない場合は保存されているバージョンと
+// 一致するときだけ更新し、一致しなければErrEditConflictを返す
+func (m *DBModel) SetMovieTags(movieID, version int, names []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM movie_tags WHERE movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	// DO UPDATEにするのは既存のタグでもRETURNINGでIDを返すため
+	upsert := `INSERT INTO tags (name, created_at, updated_at) VALUES ($1, $2, $2)
+				ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+				RETURNING id`
+	insert := `INSERT INTO movie_tags (movie_id, tag_id, created_at) VALUES ($1, $2, $3)`
+	for _, name := range names {
+		var tagID int
+		if err := tx.QueryRowContext(ctx, upsert, name, now).Scan(&tagID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, insert, movieID, tagID, now); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// RenameTag タグの名前を変更し、タグの付いた映画のバージョンを1つ進める
+// 存在しない場合はsql.ErrNoRowsを、他のタグが同じ名前の場合はErrDuplicateTagを返す
+func (m *DBModel) RenameTag(id int, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tags WHERE name = $1 AND id <> $2)`, name, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrDuplicateTag
+	}
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `UPDATE tags SET name = $1, updated_at = $2 WHERE id = $3`, name, now, id)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+	if err := reviseMovies(ctx, tx, now, `SELECT movie_id FROM movie_tags WHERE tag_id = $1`, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateTags()
+
+	return nil
+}
+
+// MergeTags sourceIDsのタグが付いた映画にtargetIDのタグを付け、sourceIDsのタグを削除する
+// タグが変わる映画（sourceIDsのタグが付いていた映画）のバージョンは1つ進める
+// いずれかのタグが存在しない場合はsql.ErrNoRowsを返し、何も変更しない
+func (m *DBModel) MergeTags(targetID int, sourceIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `UPDATE tags SET updated_at = $1 WHERE id = $2`, now, targetID)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	// タグを付け替える前に、表示が変わる映画の状態を保存しておく
+	err = reviseMovies(ctx, tx, now, `SELECT movie_id FROM movie_tags WHERE tag_id = ANY($1)`, pq.Array(sourceIDs))
+	if err != nil {
+		return err
+	}
+
+	move := `INSERT INTO movie_tags (movie_id, tag_id, created_at)
+				SELECT movie_id, $1, created_at FROM movie_tags WHERE tag_id = $2
+				ON CONFLICT (movie_id, tag_id) DO NOTHING`
+	for _, sourceID := range sourceIDs {
+		if _, err := tx.ExecContext(ctx, move, targetID, sourceID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, sourceID)
+		if err != nil {
+			return err
+		}
+		if err := rowsAffectedOrNoRows(result); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateTags()
+
+	return nil
+}
+
+// DeleteTag タグを削除し、全ての映画から外す（タグの付いていた映画のバージョンは1つ進める）
+// 存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteTag(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reviseMovies(ctx, tx, time.Now(), `SELECT movie_id FROM movie_tags WHERE tag_id = $1`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateTags()
+
+	return nil
+}
+
+// getMovieTags 映画のタグ名を名前順に返す
+func (m *DBModel) getMovieTags(ctx context.Context, movieID int) ([]string, error) {
+	query := `SELECT t.name FROM movie_tags mt
+				INNER JOIN tags t ON (t.id = mt.tag_id)
+				WHERE mt.movie_id = $1
+				ORDER BY t.name`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+
+	return tags, rows.Err()
+}
+
+// invalidateTags タグの書き込み後に、タグ名を含む映画のキャッシュを破棄する
+func (m *DBModel) invalidateTags() {
+	m.Cache.DeletePrefix(cacheKeyMovie)
+	m.Cache.DeletePrefix(cacheKeyMovies)
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// SaveMovieTranslation 映画の翻訳を作成・更新し、映画のバージョンを1つ進める
+// versionが0でない場合は保存されているバージョンと一致するときだけ保存し、
+// 一致しなければErrEditConflictを返す
+func (m *DBModel) SaveMovieTranslation(t MovieTranslation, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := snapshotMovie(ctx, tx, t.MovieID, version, t.UpdatedAt); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_translations (movie_id, locale, title, description, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $5)
+				ON CONFLICT (movie_id, locale) DO UPDATE
+				SET title = EXCLUDED.title, description = EXCLUDED.description, updated_at = EXCLUDED.updated_at`
+	_, err = tx.ExecContext(ctx, query, t.MovieID, t.Locale, t.Title, t.Description, t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, t.UpdatedAt, t.MovieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(t.MovieID)
+
+	return nil
+}
+
+// DeleteMovieTranslation 映画の翻訳を削除し、映画のバージョンを1つ進める
+// 翻訳が無い場合はsql.ErrNoRowsを、バージョンが一致しない場合はErrEditConflictを返す
+func (m *DBModel) DeleteMovieTranslation(movieID int, locale string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := snapshotMovie(ctx, tx, movieID, version, now); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM movie_translations WHERE movie_id = $1 AND locale = $2`, movieID, locale)
+	if err != nil {
+		return err
+	}
+	if err := rowsAffectedOrNoRows(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE movies SET updated_at = $1, version = version + 1 WHERE id = $2`, now, movieID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(movieID)
+
+	return nil
+}
+
+// getMovieTranslations 映画の翻訳をlocaleをキーにしたmapで返す
+func (m *DBModel) getMovieTranslations(ctx context.Context, movieID int) (map[string]*MovieTranslation, error) {
+	query := `SELECT movie_id, locale, title, description, updated_at FROM movie_translations WHERE movie_id = $1`
+	rows, err := m.conn().QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := make(map[string]*MovieTranslation)
+	for rows.Next() {
+		var t MovieTranslation
+		if err := rows.Scan(&t.MovieID, &t.Locale, &t.Title, &t.Description, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		translations[t.Locale] = &t
+	}
+
+	return translations, rows.Err()
+}
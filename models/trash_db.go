@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GetDeletedMovies ゴミ箱にあるMovieインスタンスを削除日時の新しい順に返す
+func (m *DBModel) GetDeletedMovies() ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + movieColumns + `
+				FROM movies WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id`
+
+	rows, err := m.conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+	for rows.Next() {
+		var movie Movie
+		if err := scanMovie(rows, &movie); err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		movie.MovieGenre, err = m.getMovieGenres(ctx, movie.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return movies, nil
+}
+
+// RestoreMovie ゴミ箱にあるMovieを元に戻す
+// 戻す前の状態は同じトランザクションでmovie_revisionsに保存する
+// ゴミ箱に無い場合はsql.ErrNoRowsを返す
+func (m *DBModel) RestoreMovie(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 同時に戻されないよう行ロックを取得する。ゴミ箱に無い場合はsql.ErrNoRowsになる
+	var locked int
+	err = tx.QueryRowContext(ctx, `SELECT id FROM movies WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id).Scan(&locked)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := insertRevision(ctx, tx, id, now); err != nil {
+		return err
+	}
+
+	query := `UPDATE movies SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, query, now, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.invalidateMovie(id)
+
+	return nil
+}
+
+// PurgeMovie ゴミ箱にあるMovieを完全に削除し、ストレージから削除すべき画像のキーを返す
+// ゴミ箱に無い場合はsql.ErrNoRowsを返す
+func (m *DBModel) PurgeMovie(id int) ([]string, error) {
+	n, keys, err := m.purge(`id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return keys, nil
+}
+
+// PurgeDeletedMovies beforeより前にゴミ箱に移されたMovieを完全に削除し、
+// 削除した件数とストレージから削除すべき画像のキーを返す
+func (m *DBModel) PurgeDeletedMovies(before time.Time) (int64, []string, error) {
+	return m.purge(`deleted_at < $1`, before)
+}
+
+// purge ゴミ箱にあるMovieのうちcondに一致するものを、紐づくジャンル・画像と合わせて削除する
+func (m *DBModel) purge(cond string, arg interface{}) (int64, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	target := `SELECT id FROM movies WHERE deleted_at IS NOT NULL AND ` + cond
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies_genres WHERE movie_id IN (`+target+`)`, arg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM movie_images WHERE movie_id IN (`+target+`) RETURNING key, thumbnail_key`, arg)
+	if err != nil {
+		return 0, nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key, thumbnailKey string
+		if err := rows.Scan(&key, &thumbnailKey); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		keys = append(keys, key, thumbnailKey)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM movies WHERE id IN (`+target+`)`, arg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	n, err := result.RowsAffected()
+	return n, keys, err
+}
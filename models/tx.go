@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// txTimeout Txで実行する処理全体の待ち時間
+const txTimeout = time.Minute
+
+// errRollback Txのfnがこのエラーを返した場合はロールバックし、Txはnilを返す
+var errRollback = errors.New("models: rollback")
+
+// txn DBModelの書き込みに使うトランザクション
+// Txの中で開始した場合は外側のトランザクションをそのまま使い、コミット・ロールバックは外側に任せる
+type txn struct {
+	*sql.Tx
+	nested bool
+}
+
+func (t *txn) Commit() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// begin 書き込みのトランザクションを開始する
+func (m *DBModel) begin(ctx context.Context) (*txn, error) {
+	if m.tx != nil {
+		return &txn{Tx: m.tx, nested: true}, nil
+	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx}, nil
+}
+
+// conn 読み書きに使う接続。Txの中ではそのトランザクションを返す
+func (m *DBModel) conn() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// Tx fnを1つのトランザクションで実行する。fnに渡すDBModelの読み書きは全てそのトランザクションで行い、
+// fnがエラーを返した場合はロールバックしてそのエラーを返す
+// トランザクションの中ではキャッシュを使わず、書き込みによるキャッシュの破棄はコミットした後に行う
+func (m *DBModel) Tx(fn func(db *DBModel) error) error {
+	if m.tx != nil {
+		return fn(m)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cache := &txCache{}
+	if err := fn(&DBModel{DB: m.DB, Cache: cache, tx: tx}); err != nil {
+		if err == errRollback {
+			return nil
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, prefix := range cache.deleted {
+		m.Cache.DeletePrefix(prefix)
+	}
+	return nil
+}
+
+// txCache トランザクションの中で使うCache
+// コミットしていない読み込み結果は保持せず、破棄するキーはコミットした後に本来のキャッシュへ反映する
+type txCache struct {
+	deleted []string
+}
+
+func (c *txCache) Get(key string) (interface{}, bool) { return nil, false }
+
+func (c *txCache) Set(key string, value interface{}) {}
+
+func (c *txCache) DeletePrefix(prefix string) {
+	c.deleted = append(c.deleted, prefix)
+}
+
+func (c *txCache) Stats() CacheStats { return CacheStats{} }
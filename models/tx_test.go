@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB 実行したクエリを記録するだけのデータベース
+// トランザクションの中のクエリはコミットした時点でcommittedに加え、ロールバックした場合は捨てる
+// failOnを含むクエリはエラーにする。行を返すクエリにはrowの結果（nilの場合はid 1の1列）を1行返す
+type fakeDB struct {
+	mu        sync.Mutex
+	failOn    string
+	row       func(query string) []driver.Value
+	committed []string
+}
+
+func (d *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{db: d}, nil }
+
+func (d *fakeDB) Driver() driver.Driver { return fakeDriver{d} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (f fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{db: f.db}, nil }
+
+// fakeConn 1つの接続。Beginで返すトランザクションも兼ねる
+type fakeConn struct {
+	db      *fakeDB
+	inTx    bool
+	pending []string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.committed = append(c.db.committed, c.pending...)
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) record(query string) error {
+	if c.db.failOn != "" && strings.Contains(query, c.db.failOn) {
+		return errors.New("fake: query failed")
+	}
+	if c.inTx {
+		c.pending = append(c.pending, query)
+		return nil
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.committed = append(c.db.committed, query)
+	return nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.c.record(s.query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.c.record(s.query); err != nil {
+		return nil, err
+	}
+	values := []driver.Value{int64(1)}
+	if s.c.db.row != nil {
+		values = s.c.db.row(s.query)
+	}
+	return &fakeRows{values: values}, nil
+}
+
+// fakeRows valuesの1行だけを返す
+type fakeRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, len(r.values)) }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+// TestTxRollsBackInsertedMovie Txの中で作成した映画は、後続の書き込みが失敗した場合に残らないこと
+func TestTxRollsBackInsertedMovie(t *testing.T) {
+	fake := &fakeDB{failOn: "INSERT INTO webhook_deliveries"}
+	m := &DBModel{DB: sql.OpenDB(fake), Cache: NewNoCache()}
+	defer m.DB.Close()
+
+	err := m.Tx(func(db *DBModel) error {
+		if _, err := db.InsertMovie(Movie{Title: "Heat", Year: 1995}); err != nil {
+			return err
+		}
+		_, err := db.EnqueueWebhookDeliveries("movie.created", []byte(`{}`), time.Now())
+		return err
+	})
+	if err == nil {
+		t.Fatal("Tx succeeded although queueing the webhook failed")
+	}
+
+	for _, query := range fake.committed {
+		if strings.Contains(query, "INSERT INTO movies") {
+			t.Fatalf("movie row was committed outside the transaction: %s", query)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrInvalidWatchlistOrder 並び替えに指定された映画がウォッチリストと一致しない
+var ErrInvalidWatchlistOrder = errors.New("movie_ids must contain every movie in the watchlist exactly once")
+
+// GetWatchlist ユーザーのウォッチリストをorderの順に返す（ゴミ箱にある映画は除く）
+func (m *DBModel) GetWatchlist(userID int, order WatchlistOrder) ([]*WatchlistItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	orderBy := "w.position, w.added_at"
+	switch order {
+	case WatchlistOrderAddedAt:
+		orderBy = "w.added_at DESC, w.movie_id"
+	case WatchlistOrderTitle:
+		orderBy = "m.title, w.movie_id"
+	}
+
+	query := `SELECT w.movie_id, w.position, w.note, w.added_at, w.updated_at
+				FROM watchlist w
+				INNER JOIN movies m ON (m.id = w.movie_id)
+				WHERE w.user_id = $1 AND m.deleted_at IS NULL
+				ORDER BY ` + orderBy
+	rows, err := m.conn().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*WatchlistItem{}
+	for rows.Next() {
+		var item WatchlistItem
+		if err := rows.Scan(&item.MovieID, &item.Position, &item.Note, &item.AddedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.Movie, err = m.GetMovie(item.MovieID); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// WatchlistMovieIDs ユーザーのウォッチリストにある映画のIDを返す
+func (m *DBModel) WatchlistMovieIDs(userID int) (map[int]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.conn().QueryContext(ctx, `SELECT movie_id FROM watchlist WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// WatchlistValidator ユーザーのウォッチリストの件数と最終更新日時を返す
+func (m *DBModel) WatchlistValidator(userID int) (*Validator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT count(*), COALESCE(max(updated_at), 'epoch') FROM watchlist WHERE user_id = $1`
+
+	var v Validator
+	err := m.conn().QueryRowContext(ctx, query, userID).Scan(&v.Count, &v.LastModified)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// SaveWatchlistItem 映画をウォッチリストの末尾に追加する。既にある場合はメモを更新する
+// 2つ目の戻り値は新たに追加した場合にtrue
+func (m *DBModel) SaveWatchlistItem(userID, movieID int, note string, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO watchlist (user_id, movie_id, position, note, added_at, updated_at)
+				VALUES ($1, $2, (SELECT COALESCE(max(position), 0) + 1 FROM watchlist WHERE user_id = $1), $3, $4, $4)
+				ON CONFLICT (user_id, movie_id) DO UPDATE SET note = EXCLUDED.note, updated_at = EXCLUDED.updated_at
+				RETURNING added_at = updated_at`
+	var added bool
+	err := m.conn().QueryRowContext(ctx, query, userID, movieID, note, now).Scan(&added)
+	if err != nil {
+		return false, err
+	}
+
+	return added, nil
+}
+
+// RemoveWatchlistItem 映画をウォッチリストから外す。無い場合はsql.ErrNoRowsを返す
+func (m *DBModel) RemoveWatchlistItem(userID, movieID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2`, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// ReorderWatchlist ウォッチリストをmovieIDsの順に並べ替える
+// movieIDsがウォッチリストの映画と過不足なく一致しない場合はErrInvalidWatchlistOrderを返す
+func (m *DBModel) ReorderWatchlist(userID int, movieIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT movie_id FROM watchlist WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+	current := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(movieIDs) != len(current) {
+		return ErrInvalidWatchlistOrder
+	}
+	seen := make(map[int]bool)
+	for _, id := range movieIDs {
+		if !current[id] || seen[id] {
+			return ErrInvalidWatchlistOrder
+		}
+		seen[id] = true
+	}
+
+	now := time.Now()
+	query := `UPDATE watchlist SET position = $1, updated_at = $2 WHERE user_id = $3 AND movie_id = $4`
+	for i, id := range movieIDs {
+		if _, err := tx.ExecContext(ctx, query, i+1, now, userID, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetWatchHistory ユーザーの視聴履歴を新しい順にoffset件目からlimit件返す
+// 2つ目の戻り値は履歴の総数
+func (m *DBModel) GetWatchHistory(userID, limit, offset int) ([]*WatchEvent, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.conn().QueryRowContext(ctx, `SELECT count(*) FROM watch_history WHERE user_id = $1`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, movie_id, watched_at, note FROM watch_history WHERE user_id = $1
+				ORDER BY watched_at DESC, id DESC LIMIT $2 OFFSET $3`
+	rows, err := m.conn().QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*WatchEvent{}
+	for rows.Next() {
+		var e WatchEvent
+		if err := rows.Scan(&e.ID, &e.MovieID, &e.WatchedAt, &e.Note); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// 履歴はゴミ箱にある映画のものも残し、映画の詳細だけを省く
+	for _, e := range events {
+		e.Movie, err = m.GetMovie(e.MovieID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return events, total, nil
+}
+
+// InsertWatchEvent 視聴履歴を追加し、採番されたIDを返す
+func (m *DBModel) InsertWatchEvent(userID int, e WatchEvent) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO watch_history (user_id, movie_id, watched_at, note, created_at)
+				VALUES ($1, $2, $3, $4, now()) RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, userID, e.MovieID, e.WatchedAt, e.Note).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteWatchEvent ユーザーの視聴履歴を1件削除する。無い場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteWatchEvent(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM watch_history WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffectedOrNoRows(result)
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"time"
+)
+
+const webhookColumns = `id, url, secret, event_types, active, created_at, updated_at`
+
+func scanWebhook(row scanner, w *Webhook) error {
+	return row.Scan(
+		&w.ID,
+		&w.URL,
+		&w.Secret,
+		pq.Array(&w.EventTypes),
+		&w.Active,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+}
+
+const deliveryColumns = `id, webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at`
+
+func scanDelivery(row scanner, d *WebhookDelivery) error {
+	return row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventType,
+		(*[]byte)(&d.Payload),
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+}
+
+// GetWebhooks Webhookを登録順に返す
+func (m *DBModel) GetWebhooks() ([]*Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.conn().QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// GetWebhook IDに一致するWebhookを返す
+func (m *DBModel) GetWebhook(id int) (*Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var w Webhook
+	row := m.conn().QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+	if err := scanWebhook(row, &w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// InsertWebhook Webhookを新規作成し、採番されたIDを返す
+func (m *DBModel) InsertWebhook(w Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO webhooks (url, secret, event_types, active, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING id`
+	var id int
+	err := m.conn().QueryRowContext(ctx, query, w.URL, w.Secret, pq.Array(w.EventTypes), w.Active, w.CreatedAt, w.UpdatedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateWebhook WebhookのURL・イベントの種類・有効かどうかと、Secretが空でなければ署名の鍵を更新する
+// 存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) UpdateWebhook(w Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhooks SET url = $1, secret = COALESCE(NULLIF($2, ''), secret), event_types = $3, active = $4, updated_at = $5
+				WHERE id = $6`
+	result, err := m.conn().ExecContext(ctx, query, w.URL, w.Secret, pq.Array(w.EventTypes), w.Active, w.UpdatedAt, w.ID)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// DeleteWebhook Webhookとその配信キュー・配信ログを削除する。存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) DeleteWebhook(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.conn().ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffectedOrNoRows(result)
+}
+
+// EnqueueWebhookDeliveries eventTypeを購読している有効なWebhookごとに、payloadの配信をキューに追加する
+// 購読は種類の完全一致、"movie.*"のような同じ接頭辞のワイルドカード、"*"のいずれかで判定する。追加した件数を返す
+func (m *DBModel) EnqueueWebhookDeliveries(eventType string, payload []byte, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+				SELECT id, $1, $2, 'pending', $3, $3, $3 FROM webhooks
+				WHERE active AND ($1 = ANY(event_types) OR split_part($1, '.', 1) || '.*' = ANY(event_types) OR '*' = ANY(event_types))`
+	result, err := m.conn().ExecContext(ctx, query, eventType, string(payload), now)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// ClaimWebhookDeliveries 送信時刻を過ぎた配信（有効なWebhookのもの）を古い順に最大limit件取り出す
+// 取り出した配信は送信中に他のプロセスが重ねて送らないよう、次の送信時刻をleaseUntilまで延ばしておく
+func (m *DBModel) ClaimWebhookDeliveries(limit int, now, leaseUntil time.Time) ([]*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d SET next_attempt_at = $3
+				FROM webhooks w
+				WHERE w.id = d.webhook_id AND d.id IN (
+					SELECT qd.id FROM webhook_deliveries qd
+					INNER JOIN webhooks qw ON (qw.id = qd.webhook_id)
+					WHERE qd.status = 'pending' AND qd.next_attempt_at <= $2 AND qw.active
+					ORDER BY qd.next_attempt_at, qd.id
+					LIMIT $1
+					FOR UPDATE OF qd SKIP LOCKED
+				)
+				RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+					d.created_at, d.updated_at, w.url, w.secret`
+	rows, err := m.conn().QueryContext(ctx, query, limit, now, leaseUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, (*[]byte)(&d.Payload), &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.CreatedAt, &d.UpdatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt 送信1回の結果を配信ログに記録し、配信の状態と次の送信時刻を更新する
+func (m *DBModel) RecordWebhookAttempt(deliveryID int64, a WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error, duration_ms, attempted_at)
+				VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.ExecContext(ctx, query, deliveryID, a.ResponseStatus, a.Error, a.DurationMS, a.AttemptedAt); err != nil {
+		return err
+	}
+
+	query = `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, next_attempt_at = $2, updated_at = $3
+				WHERE id = $4`
+	if _, err := tx.ExecContext(ctx, query, status, nextAttemptAt, a.AttemptedAt, deliveryID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWebhookDeliveries Webhookの配信を新しい順にoffset件目からlimit件返す（配信ログは含めない）
+// 2つ目の戻り値は配信の総数
+func (m *DBModel) GetWebhookDeliveries(webhookID, limit, offset int) ([]*WebhookDelivery, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.conn().QueryRowContext(ctx, `SELECT count(*) FROM webhook_deliveries WHERE webhook_id = $1`, webhookID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = $1
+				ORDER BY id DESC LIMIT $2 OFFSET $3`
+	rows, err := m.conn().QueryContext(ctx, query, webhookID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, total, rows.Err()
+}
+
+// GetWebhookDelivery 配信を配信ログと合わせて返す
+func (m *DBModel) GetWebhookDelivery(id int64) (*WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var d WebhookDelivery
+	row := m.conn().QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+	if err := scanDelivery(row, &d); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, response_status, error, duration_ms, attempted_at
+				FROM webhook_delivery_attempts WHERE delivery_id = $1
+				ORDER BY attempted_at, id`
+	rows, err := m.conn().QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.Log = []*WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var a WebhookDeliveryAttempt
+		if err := rows.Scan(&a.ID, &a.ResponseStatus, &a.Error, &a.DurationMS, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		d.Log = append(d.Log, &a)
+	}
+
+	return &d, rows.Err()
+}
+
+// RedeliverWebhookDelivery 配信をキューに戻し、試行回数を0にしてすぐに送信し直す（配信ログは残す）
+// 存在しない場合はsql.ErrNoRowsを返す
+func (m *DBModel) RedeliverWebhookDelivery(id int64, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $1, updated_at = $1
+				WHERE id = $2`
+	result, err := m.conn().ExecContext(ctx, query, now, id)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffectedOrNoRows(result)
+}
@@ -25,6 +25,11 @@ func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err)
 		return
 	}
+	region, err := regionFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
 	movie, err := app.models.DB.GetMovie(id)
 	if err != nil {
@@ -32,7 +37,28 @@ func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, movie, "movie")
+	etag, lastModified, err := app.personalValidator(w, r, movieETag(movie), movieLastModified(movie))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	locales := preferredLocales(r)
+	etag = localeETag(w, etag, locales)
+	if app.notModified(w, r, etag, lastModified) {
+		return
+	}
+
+	movie = localizeMovie(regionalizeMovie(movie, region), locales)
+	if movie.Locale != "" {
+		w.Header().Set("Content-Language", movie.Locale)
+	}
+	movies, err := app.withWatchlistFlags(r, []*models.Movie{movie})
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, movies[0], "movie")
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -40,11 +66,40 @@ func (app *application) getMovie(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
+	region, err := regionFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	v, err := app.models.DB.MoviesValidator()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	etag, lastModified, err := app.personalValidator(w, r, listETag("movies", v), v.LastModified)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	locales := preferredLocales(r)
+	etag = localeETag(w, etag, locales)
+	if app.notModified(w, r, etag, lastModified) {
+		return
+	}
+
 	movies, err := app.models.DB.GetAllMovies()
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
+	movies = filterMoviesByTags(movies, tagsFromQuery(r.URL.Query()))
+	movies = filterMoviesByProviders(regionalizeMovies(movies, region), providersFromQuery(r.URL.Query()))
+	movies, err = app.withWatchlistFlags(r, localizeMovies(movies, locales))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
 	err = app.writeJSON(w, http.StatusOK, movies, "movies")
 	if err != nil {
@@ -60,12 +115,24 @@ func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Reque
 		app.errorJSON(w, err)
 		return
 	}
+	region, err := regionFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
 	movies, err := app.models.DB.GetAllMovies(genreID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
+	w.Header().Add("Vary", "Authorization")
+	w.Header().Add("Vary", "Accept-Language")
+	movies, err = app.withWatchlistFlags(r, localizeMovies(regionalizeMovies(movies, region), preferredLocales(r)))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
 	err = app.writeJSON(w, http.StatusOK, movies, "movies")
 	if err != nil {
@@ -82,6 +149,7 @@ type MoviePayload struct {
 	Runtime     int    `json:"runtime"`
 	Rating      int    `json:"rating"`
 	MPAARating  string `json:"mpaa_rating"`
+	Version     int    `json:"version"`
 }
 
 func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
@@ -94,10 +162,28 @@ func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+	expectedVersion, err := ifMatchVersion(r, payload.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
 	var movie models.Movie
+	var before *models.Movie
 
 	if payload.ID != 0 {
-		m, _ := app.models.DB.GetMovie(payload.ID)
+		m, err := app.models.DB.GetMovie(payload.ID)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		before = m
 		movie = *m
 		movie.UpdatedAt = time.Now()
 	}
@@ -110,20 +196,46 @@ func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
 	movie.Runtime = payload.Runtime
 	movie.Rating = payload.Rating
 	movie.MPAARating = payload.MPAARating
+	movie.Version = expectedVersion
 	movie.CreatedAt = time.Now()
 	movie.UpdatedAt = time.Now()
 
 	// IDが0の場合は新規作成
-	if movie.ID == 0 {
-		err = app.models.DB.InsertMovie(movie)
-	} else {
-		err = app.models.DB.UpdateMovie(movie)
+	// 保存後の状態を同じトランザクションで監査ログに記録し、Webhookの配信をキューに追加する
+	e, action := event{Type: eventMovieUpdated, OccurredAt: time.Now()}, auditUpdate
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var err error
+		if movie.ID == 0 {
+			e.Type, action = eventMovieCreated, auditCreate
+			movie.ID, err = db.InsertMovie(movie)
+		} else {
+			err = db.UpdateMovie(movie)
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.Movie, err = db.GetMovie(movie.ID); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, action, auditEntityMovie, movie.ID, before, e.Movie); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
 	}
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	// 保存後の状態を購読者に通知する
+	w.Header().Set("ETag", movieETag(e.Movie))
+	app.events.publish(e)
+
 	ok := jsonRes{OK: true}
 
 	err = app.writeJSON(w, http.StatusOK, ok, "response")
@@ -143,12 +255,40 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.DB.DeleteMovie(id)
+	// 削除イベントで削除前の状態を通知するため先に取得しておく
+	movie, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	e := event{Type: eventMovieDeleted, Movie: movie, OccurredAt: time.Now()}
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		if err := db.DeleteMovie(id, version); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, auditDelete, auditEntityMovie, id, movie, nil); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
+	app.events.publish(e)
+
 	ok := jsonRes{OK: true}
 
 	err = app.writeJSON(w, http.StatusOK, ok, "response")
@@ -157,3 +297,30 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// changeMovie 映画に紐づくデータをwriteで変更し、保存後の映画を同じトランザクションで監査ログに記録して
+// Webhookの配信をキューに追加する。コミットした後に保存後の映画を購読者に通知し、ETagヘッダーを設定する
+func (app *application) changeMovie(w http.ResponseWriter, r *http.Request, before *models.Movie, write func(db *models.DBModel) error) error {
+	e := event{Type: eventMovieUpdated, OccurredAt: time.Now()}
+	err := app.models.DB.Tx(func(db *models.DBModel) error {
+		if err := write(db); err != nil {
+			return err
+		}
+
+		var err error
+		if e.Movie, err = db.GetMovie(before.ID); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, auditUpdate, auditEntityMovie, before.ID, before, e.Movie); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", movieETag(e.Movie))
+	app.events.publish(e)
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// routeDoc OpenAPIドキュメントに載せるルートの説明
+// request・responseには実際にエンコード・デコードする型のゼロ値を指定し、スキーマはその型から生成する
+type routeDoc struct {
+	tag     string
+	summary string
+	// query クエリパラメータ名と説明
+	query map[string]string
+	// request リクエストボディの型
+	request interface{}
+	// response レスポンスの型。wrapが指定されている場合はwriteJSONと同様にそのキーで包む
+	response interface{}
+	wrap     string
+	// status 成功時のステータスコード（0の場合は200）
+	status int
+	// rawResponse レスポンスがJSONのラッパー形式でない場合にtrueにする
+	rawResponse bool
+}
+
+// openAPIHandler 生成済みのOpenAPIドキュメントを返す
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(app.openAPI)
+}
+
+// buildOpenAPI ルーティングテーブルからOpenAPI 3のドキュメントを生成する
+// ドキュメントの無いルートがある場合はエラーを返す
+func (app *application) buildOpenAPI() ([]byte, error) {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+
+	errorSchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"errors": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	}
+	g.schemas["Error"] = errorSchema
+
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range app.routeTable() {
+		if rt.doc.summary == "" || rt.doc.tag == "" {
+			return nil, fmt.Errorf("openapi: route %s %s is not documented", rt.method, rt.path)
+		}
+
+		path, params := openAPIPath(rt.path)
+		for name, description := range rt.doc.query {
+			params = append(params, map[string]interface{}{
+				"name":        name,
+				"in":          "query",
+				"description": description,
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+
+		op := map[string]interface{}{
+			"tags":        []string{rt.doc.tag},
+			"summary":     rt.doc.summary,
+			"operationId": operationID(rt.method, rt.path),
+			"responses":   g.responses(rt),
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.doc.request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(rt.doc.request))},
+				},
+			}
+		}
+		if rt.secure {
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		method := strings.ToLower(rt.method)
+		if _, ok := paths[path][method]; ok {
+			return nil, fmt.Errorf("openapi: route %s %s is registered twice", rt.method, rt.path)
+		}
+		paths[path][method] = op
+
+		if g.err != nil {
+			return nil, fmt.Errorf("%w (route %s %s)", g.err, rt.method, rt.path)
+		}
+	}
+
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "MoviesManage API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(spec, "", "\t")
+}
+
+// responses ルートのレスポンス定義を返す
+func (g *schemaGenerator) responses(rt route) map[string]interface{} {
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+
+	ok := map[string]interface{}{"description": "OK"}
+	if !rt.doc.rawResponse {
+		schema := g.schemaOf(reflect.TypeOf(rt.doc.response))
+		if rt.doc.wrap != "" {
+			schema = map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{rt.doc.wrap: schema},
+			}
+		}
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		}
+	}
+
+	status := http.StatusOK
+	if rt.doc.status != 0 {
+		status = rt.doc.status
+		ok["description"] = http.StatusText(status)
+	}
+
+	res := map[string]interface{}{
+		fmt.Sprint(status): ok,
+		"400":              errorResponse,
+	}
+	if rt.secure {
+		res["401"] = errorResponse
+		res["403"] = errorResponse
+	}
+
+	return res
+}
+
+// integerPathParams 整数のIDを受け取るパスパラメータ。それ以外（external_idなど）は文字列とする
+var integerPathParams = map[string]bool{"id": true, "image_id": true}
+
+// openAPIPath httprouterのパスをOpenAPIのパスに変換し、パスパラメータの定義を返す
+func openAPIPath(path string) (string, []map[string]interface{}) {
+	var params []map[string]interface{}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if !strings.HasPrefix(s, ":") && !strings.HasPrefix(s, "*") {
+			continue
+		}
+		name := s[1:]
+		segments[i] = "{" + name + "}"
+
+		typ := "string"
+		if integerPathParams[name] {
+			typ = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": typ},
+		})
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID メソッドとパスから一意なoperationIdを作る
+func operationID(method, path string) string {
+	replacer := strings.NewReplacer("/", "_", ":", "by_", "-", "_", ".", "_", "*", "")
+	return strings.ToLower(method) + strings.TrimRight(replacer.Replace(path), "_")
+}
+
+// schemaGenerator Goの型からJSON Schemaを生成する
+// 名前付きの構造体はcomponents.schemasに登録し$refで参照する
+// 対応していない型があった場合は空のスキーマを返し、最初のエラーをerrに残す
+type schemaGenerator struct {
+	schemas map[string]interface{}
+	err     error
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var errUnsupportedType = errors.New("openapi: unsupported type")
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// 再帰的な型に備えて先に登録しておく
+			g.schemas[t.Name()] = map[string]interface{}{}
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	if g.err == nil {
+		g.err = fmt.Errorf("%w: %s", errUnsupportedType, t)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema encoding/jsonと同じ規則で構造体のプロパティを列挙する
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	g.addFields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaOf(f.Type)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// expectedRoutes 公開しているAPIのメソッドとパス
+// ルートを追加・削除した場合はここも更新する
+var expectedRoutes = []struct {
+	method, path string
+}{
+	{"GET", "/status"},
+	{"GET", "/v1/openapi.json"},
+	{"POST", "/v1/graphql"},
+	{"GET", "/v1/graphql"},
+	{"GET", "/v1/images/*filepath"},
+	{"POST", "/v1/login"},
+	{"GET", "/v1/movies"},
+	{"GET", "/v1/movies/:id"},
+	{"GET", "/v1/movies/:id/similar"},
+	{"GET", "/v1/movies/:id/reviews"},
+	{"POST", "/v1/movies/:id/reviews"},
+	{"GET", "/v1/lookup/:source/:external_id"},
+	{"GET", "/v1/tags"},
+	{"GET", "/v1/stats"},
+	{"GET", "/v1/providers"},
+	{"GET", "/v1/collections"},
+	{"GET", "/v1/collections/:slug"},
+	{"PUT", "/v1/reviews/:id"},
+	{"DELETE", "/v1/reviews/:id"},
+	{"POST", "/v1/admin/movie/edit"},
+	{"DELETE", "/v1/admin/movie/delete/:id"},
+	{"POST", "/v1/admin/movies/import"},
+	{"GET", "/v1/admin/movies/export"},
+	{"POST", "/v1/admin/movie/images/:id"},
+	{"DELETE", "/v1/admin/movie/images/:id/:image_id"},
+	{"POST", "/v1/admin/movie/credits/:id"},
+	{"POST", "/v1/admin/movie/tags/:id"},
+	{"POST", "/v1/admin/movie/releases/:id"},
+	{"GET", "/v1/admin/movie/availability/:id"},
+	{"POST", "/v1/admin/movie/availability/:id"},
+	{"POST", "/v1/admin/providers/edit"},
+	{"DELETE", "/v1/admin/providers/delete/:id"},
+	{"POST", "/v1/admin/genres/edit"},
+	{"DELETE", "/v1/admin/genres/delete/:id"},
+	{"GET", "/v1/admin/webhooks"},
+	{"POST", "/v1/admin/webhooks/edit"},
+	{"DELETE", "/v1/admin/webhooks/delete/:id"},
+	{"GET", "/v1/admin/webhooks/deliveries/:id"},
+	{"GET", "/v1/admin/webhooks/delivery/:id"},
+	{"POST", "/v1/admin/webhooks/redeliver/:id"},
+	{"POST", "/v1/admin/movie/external-ids/:id"},
+	{"POST", "/v1/admin/movie/metadata/:id"},
+	{"POST", "/v1/admin/tags/rename/:id"},
+	{"POST", "/v1/admin/tags/merge"},
+	{"DELETE", "/v1/admin/tags/delete/:id"},
+	{"POST", "/v1/admin/collections/edit"},
+	{"DELETE", "/v1/admin/collections/delete/:id"},
+	{"PUT", "/v1/admin/collections/movies/:id"},
+	{"GET", "/v1/admin/movie/translations/:id"},
+	{"POST", "/v1/admin/movie/translations/:id"},
+	{"DELETE", "/v1/admin/movie/translations/:id/:locale"},
+	{"GET", "/v1/admin/movies/trash"},
+	{"POST", "/v1/admin/movie/restore/:id"},
+	{"DELETE", "/v1/admin/movie/purge/:id"},
+	{"GET", "/v1/admin/movie/revisions/:id"},
+	{"GET", "/v1/admin/movie/revisions/:id/diff"},
+	{"POST", "/v1/admin/movie/revisions/:id/rollback"},
+	{"GET", "/v1/admin/audit"},
+	{"GET", "/v1/admin/people"},
+	{"POST", "/v1/admin/people/edit"},
+	{"DELETE", "/v1/admin/people/delete/:id"},
+	{"GET", "/v1/people/:id"},
+	{"GET", "/v1/me/watchlist"},
+	{"POST", "/v1/me/watchlist"},
+	{"PUT", "/v1/me/watchlist/order"},
+	{"DELETE", "/v1/me/watchlist/:id"},
+	{"GET", "/v1/me/history"},
+	{"POST", "/v1/me/history"},
+	{"DELETE", "/v1/me/history/:id"},
+	{"GET", "/v1/genres"},
+	{"GET", "/v1/genres/:id"},
+}
+
+// TestOpenAPICoversRoutes 公開しているAPIが全てルーターに登録され、OpenAPIドキュメントに載っていること
+// ドキュメントに余分な操作が無いことも確かめる
+func TestOpenAPICoversRoutes(t *testing.T) {
+	app := &application{}
+	router := app.router()
+
+	b, err := app.buildOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range expectedRoutes {
+		if h, _, _ := router.Lookup(want.method, want.path); h == nil {
+			t.Errorf("%s %s is not registered", want.method, want.path)
+		}
+		path, _ := openAPIPath(want.path)
+		if _, ok := spec.Paths[path][strings.ToLower(want.method)]; !ok {
+			t.Errorf("%s %s is missing from the OpenAPI document", want.method, want.path)
+		}
+	}
+
+	operations := 0
+	for _, ops := range spec.Paths {
+		operations += len(ops)
+	}
+	if operations != len(expectedRoutes) {
+		t.Errorf("OpenAPI document has %d operations, want %d", operations, len(expectedRoutes))
+	}
+}
+
+// TestSchemaOfUnsupportedType 対応していない型はpanicせずにエラーとして残すこと
+func TestSchemaOfUnsupportedType(t *testing.T) {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+	g.schemaOf(reflect.TypeOf(struct {
+		Done chan bool `json:"done"`
+	}{}))
+
+	if !errors.Is(g.err, errUnsupportedType) {
+		t.Errorf("err = %v, want %v", g.err, errUnsupportedType)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validCreditRoles クレジットに指定できる役割
+var validCreditRoles = map[string]bool{models.CreditActor: true, models.CreditDirector: true, models.CreditWriter: true}
+
+// PersonPayload 人物の作成・更新のリクエストボディ
+type PersonPayload struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Biography string `json:"biography"`
+	BirthDate string `json:"birth_date"`
+}
+
+// CreditPayload 映画のクレジット1件
+type CreditPayload struct {
+	PersonID  int    `json:"person_id"`
+	Role      string `json:"role"`
+	Character string `json:"character"`
+	Order     int    `json:"order"`
+}
+
+// CreditsPayload 映画のクレジットを置き換えるリクエストボディ
+type CreditsPayload struct {
+	Version int             `json:"version"`
+	Credits []CreditPayload `json:"credits"`
+}
+
+// getPerson 人物を出演・担当した映画と合わせて返す
+func (app *application) getPerson(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	person, err := app.models.DB.GetPerson(id)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("person not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, person, "person")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getPeople 人物の一覧を返す
+// クエリパラメータ: name (部分一致)
+func (app *application) getPeople(w http.ResponseWriter, r *http.Request) {
+	people, err := app.models.DB.GetPeople(r.URL.Query().Get("name"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, people, "people")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editPerson IDが0の場合は人物を作成し、それ以外の場合は更新する
+func (app *application) editPerson(w http.ResponseWriter, r *http.Request) {
+	var payload PersonPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	person := models.Person{
+		ID:        payload.ID,
+		Name:      strings.TrimSpace(payload.Name),
+		Biography: payload.Biography,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if person.Name == "" {
+		app.errorJSON(w, errors.New("name is required"))
+		return
+	}
+	if payload.BirthDate != "" {
+		birthDate, err := time.Parse("2006-01-02", payload.BirthDate)
+		if err != nil {
+			app.errorJSON(w, errors.New("birth_date must be a date in YYYY-MM-DD format"))
+			return
+		}
+		person.BirthDate = &birthDate
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var before *models.Person
+		var err error
+		action := auditUpdate
+		if person.ID == 0 {
+			action = auditCreate
+			person.ID, err = db.InsertPerson(person)
+		} else {
+			before, err = db.GetPerson(person.ID)
+			if err == nil {
+				// 監査ログには人物の項目だけを記録する
+				before.Filmography = nil
+				err = db.UpdatePerson(person)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, action, auditEntityPerson, person.ID, before, person)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("person not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deletePerson 人物とそのクレジットを削除する
+func (app *application) deletePerson(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetPerson(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeletePerson(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditDelete, auditEntityPerson, id, before, nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("person not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editMovieCredits 映画のクレジットを置き換える
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieCredits(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload CreditsPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	credits := make([]models.Credit, 0, len(payload.Credits))
+	for i, c := range payload.Credits {
+		if c.PersonID <= 0 {
+			app.errorJSON(w, fmt.Errorf("credits[%d]: person_id is required", i))
+			return
+		}
+		if !validCreditRoles[c.Role] {
+			app.errorJSON(w, fmt.Errorf("credits[%d]: role must be one of actor, director, writer", i))
+			return
+		}
+		credits = append(credits, models.Credit{PersonID: c.PersonID, Role: c.Role, Character: c.Character, Order: c.Order})
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SetMovieCredits(id, expectedVersion, credits)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countryPattern ISO 3166-1 alpha-2の国コード
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// certifications 国ごとに受け付けるレーティングの区分
+// 米国はmpaa_ratingと同じ表記、日本は映倫、英国はBBFC、ドイツはFSKの区分
+var certifications = map[string][]string{
+	"US": {"G", "PG", "PG13", "R", "NC17"},
+	"JP": {"G", "PG12", "R15+", "R18+"},
+	"GB": {"U", "PG", "12A", "12", "15", "18", "R18"},
+	"DE": {"0", "6", "12", "16", "18"},
+}
+
+// validReleaseTypes 公開の種類
+var validReleaseTypes = map[string]bool{models.ReleaseTheatrical: true, models.ReleaseDigital: true}
+
+// ReleasePayload 国ごとの公開1件
+// typeは省略した場合theatrical、dateはYYYY-MM-DD形式、certificationは省略可
+type ReleasePayload struct {
+	Country       string `json:"country"`
+	Type          string `json:"type"`
+	Date          string `json:"date"`
+	Certification string `json:"certification"`
+}
+
+// ReleasesPayload 映画の国ごとの公開を置き換えるリクエストボディ
+type ReleasesPayload struct {
+	Version  int              `json:"version"`
+	Releases []ReleasePayload `json:"releases"`
+}
+
+// normalizeCountry 国コードを大文字にする。不正な場合は空文字を返す
+func normalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !countryPattern.MatchString(code) {
+		return ""
+	}
+	return code
+}
+
+// validateRelease 公開1件を検証し、models.Releaseにする
+func validateRelease(p ReleasePayload) (models.Release, error) {
+	r := models.Release{
+		Country:       normalizeCountry(p.Country),
+		Type:          p.Type,
+		Certification: strings.TrimSpace(p.Certification),
+	}
+	if r.Country == "" {
+		return r, errors.New("country must be an ISO 3166-1 alpha-2 code such as JP or US")
+	}
+	if r.Type == "" {
+		r.Type = models.ReleaseTheatrical
+	}
+	if !validReleaseTypes[r.Type] {
+		return r, errors.New("type must be theatrical or digital")
+	}
+
+	var err error
+	r.Date, err = time.Parse("2006-01-02", p.Date)
+	if err != nil {
+		return r, errors.New("date must be a date in YYYY-MM-DD format")
+	}
+
+	if r.Certification == "" {
+		return r, nil
+	}
+	valid, ok := certifications[r.Country]
+	if !ok {
+		return r, fmt.Errorf("certifications for %s are not supported: leave certification empty", r.Country)
+	}
+	for _, c := range valid {
+		if c == r.Certification {
+			return r, nil
+		}
+	}
+	return r, fmt.Errorf("certification for %s must be one of %s", r.Country, strings.Join(valid, ", "))
+}
+
+// regionFromQuery クエリパラメータregionの国コードを返す（指定が無い場合は空文字）
+func regionFromQuery(q url.Values) (string, error) {
+	region := q.Get("region")
+	if region == "" {
+		return "", nil
+	}
+	if region = normalizeCountry(region); region == "" {
+		return "", errors.New("region must be an ISO 3166-1 alpha-2 code such as JP or US")
+	}
+	return region, nil
+}
+
+// regionFromGraphQL GraphQLの引数regionの国コードを返す（指定が無い・不正な場合は空文字）
+func regionFromGraphQL(args map[string]interface{}) string {
+	region, _ := args["region"].(string)
+	return normalizeCountry(region)
+}
+
+// regionalizeMovie 配信を現在視聴できるものに絞り込み、地域を指定した場合は公開と配信をその国のものに絞り込んだ複製を返す
+// その国の公開がある場合は劇場公開（無ければ配信）の最も早いものの公開日とレーティングを表示する
+func regionalizeMovie(movie *models.Movie, region string) *models.Movie {
+	movie = availableNow(movie, region, time.Now())
+	if region == "" {
+		return movie
+	}
+
+	m := *movie
+	m.Releases = []*models.Release{}
+	var selected *models.Release
+	for _, r := range movie.Releases {
+		if r.Country != region {
+			continue
+		}
+		m.Releases = append(m.Releases, r)
+		if selected == nil || (r.Type == models.ReleaseTheatrical && selected.Type != models.ReleaseTheatrical) ||
+			(r.Type == selected.Type && r.Date.Before(selected.Date)) {
+			selected = r
+		}
+	}
+	if selected != nil {
+		m.Region = region
+		m.ReleaseDate = selected.Date
+		m.Certification = selected.Certification
+	}
+	return &m
+}
+
+// regionalizeMovies moviesにregionalizeMovieを適用したスライスを返す
+func regionalizeMovies(movies []*models.Movie, region string) []*models.Movie {
+	regionalized := make([]*models.Movie, len(movies))
+	for i, movie := range movies {
+		regionalized[i] = regionalizeMovie(movie, region)
+	}
+	return regionalized
+}
+
+// editMovieReleases 映画の国ごとの公開日とレーティングを置き換える
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieReleases(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload ReleasesPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	releases := make([]models.Release, 0, len(payload.Releases))
+	seen := make(map[string]bool)
+	for i, p := range payload.Releases {
+		release, err := validateRelease(p)
+		if err != nil {
+			app.errorJSON(w, fmt.Errorf("releases[%d]: %v", i, err))
+			return
+		}
+		key := release.Country + ":" + release.Type
+		if seen[key] {
+			app.errorJSON(w, fmt.Errorf("releases[%d]: %s release in %s is listed more than once", i, release.Type, release.Country))
+			return
+		}
+		seen[key] = true
+		releases = append(releases, release)
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SetMovieReleases(id, expectedVersion, releases)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
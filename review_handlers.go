@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// レビュー一覧の1ページの件数
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+)
+
+// maxReviewBody レビュー本文の最大文字数
+const maxReviewBody = 10000
+
+// ReviewPayload レビューの作成・更新のリクエストボディ
+type ReviewPayload struct {
+	Score int    `json:"score"`
+	Body  string `json:"body"`
+}
+
+// pageMetadata limit・offsetで取得した一覧の総数と取得範囲
+type pageMetadata struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// reviewList レビュー一覧のレスポンス
+type reviewList struct {
+	Reviews  []*models.Review `json:"reviews"`
+	Metadata pageMetadata     `json:"metadata"`
+}
+
+// parsePage クエリパラメータlimit・offsetを読み取る。limitが無い場合はdefaultLimitとする
+func parsePage(q url.Values, defaultLimit, maxLimit int) (pageMetadata, error) {
+	page := pageMetadata{Limit: defaultLimit}
+	for name, dest := range map[string]*int{"limit": &page.Limit, "offset": &page.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return page, errors.New("invalid " + name + " parameter")
+			}
+			*dest = n
+		}
+	}
+	if page.Limit < 1 || page.Limit > maxLimit {
+		return page, errors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+	}
+	return page, nil
+}
+
+func (p ReviewPayload) validate() error {
+	if p.Score < 1 || p.Score > 5 {
+		return errors.New("score must be between 1 and 5")
+	}
+	if len([]rune(p.Body)) > maxReviewBody {
+		return errors.New("body must not be longer than " + strconv.Itoa(maxReviewBody) + " characters")
+	}
+	return nil
+}
+
+// getMovieReviews 映画のレビューを新しい順に返す
+// クエリパラメータ: limit (デフォルト20、最大100), offset
+func (app *application) getMovieReviews(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var res reviewList
+	res.Metadata, err = parsePage(r.URL.Query(), defaultReviewLimit, maxReviewLimit)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if _, err := app.models.DB.GetMovie(movieID); err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	res.Reviews, res.Metadata.Total, err = app.models.DB.GetReviews(movieID, res.Metadata.Limit, res.Metadata.Offset)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, res, "")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// createReview ログインしているユーザーとして映画をレビューする（1作品につき1件）
+func (app *application) createReview(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload ReviewPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if err := payload.validate(); err != nil {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, err := app.models.DB.GetMovie(movieID); err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	review := models.Review{
+		MovieID:   movieID,
+		UserID:    userIDFromContext(r.Context()),
+		Score:     payload.Score,
+		Body:      payload.Body,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	review.ID, err = app.models.DB.InsertReview(review)
+	if err == models.ErrDuplicateReview {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, review, "review")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// updateReview 自分のレビューの点数と本文を更新する
+func (app *application) updateReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.ownReview(w, r)
+	if !ok {
+		return
+	}
+
+	var payload ReviewPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if err := payload.validate(); err != nil {
+		app.errorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	review.Score = payload.Score
+	review.Body = payload.Body
+	review.UpdatedAt = time.Now()
+
+	err := app.models.DB.UpdateReview(*review)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, review, "review")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteReview 自分のレビューを削除する
+func (app *application) deleteReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.ownReview(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.DB.DeleteReview(*review)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, jsonRes{OK: true}, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// ownReview パスパラメータidのレビューを取得する
+// 存在しない場合とログインしているユーザーのものでない場合はエラーを書き込んでfalseを返す
+func (app *application) ownReview(w http.ResponseWriter, r *http.Request) (*models.Review, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return nil, false
+	}
+
+	review, err := app.models.DB.GetReview(id)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("review not found"), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return nil, false
+	}
+
+	if review.UserID != userIDFromContext(r.Context()) {
+		app.errorJSON(w, errors.New("you can only change your own reviews"), http.StatusForbidden)
+		return nil, false
+	}
+
+	return review, true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// revisionDiff 2つの状態の比較結果
+type revisionDiff struct {
+	From    *models.MovieRevision `json:"from"`
+	To      *models.MovieRevision `json:"to"`
+	Changes json.RawMessage       `json:"changes"`
+}
+
+// RollbackPayload 映画を過去の状態に戻す際のリクエスト
+type RollbackPayload struct {
+	Version int `json:"version"`
+}
+
+// getMovieRevisions 映画の過去の状態の一覧を返す
+func (app *application) getMovieRevisions(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	revisions, err := app.models.DB.GetMovieRevisions(id)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, revisions, "revisions")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// diffMovieRevisions 映画の2つのバージョンの差分を返す
+// toを省略した場合は現在の状態と比較する
+func (app *application) diffMovieRevisions(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid from parameter"))
+		return
+	}
+
+	var to int
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			app.errorJSON(w, errors.New("invalid to parameter"))
+			return
+		}
+	} else {
+		movie, err := app.models.DB.GetMovie(id)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		to = movie.Version
+	}
+
+	var diff revisionDiff
+	if diff.From, err = app.models.DB.GetMovieRevision(id, from); err != nil {
+		app.revisionErrorJSON(w, err, from)
+		return
+	}
+	if diff.To, err = app.models.DB.GetMovieRevision(id, to); err != nil {
+		app.revisionErrorJSON(w, err, to)
+		return
+	}
+
+	diff.Changes, err = models.DiffRevisions(diff.From, diff.To)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, diff, "diff")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// revisionErrorJSON 状態の取得に失敗した場合のエラーを返す
+func (app *application) revisionErrorJSON(w http.ResponseWriter, err error, version int) {
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("revision "+strconv.Itoa(version)+" not found"), http.StatusNotFound)
+		return
+	}
+	app.errorJSON(w, err)
+}
+
+// rollbackMovie 映画を指定したバージョンの状態に戻す
+func (app *application) rollbackMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload RollbackPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	// 現在のバージョンに戻す場合は何も変わらないため、監査ログにも記録せず購読者にも通知しない
+	e := event{Type: eventMovieUpdated, OccurredAt: time.Now(), Movie: before}
+	changed := false
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var err error
+		if changed, err = db.RollbackMovie(id, payload.Version, expectedVersion); err != nil || !changed {
+			return err
+		}
+
+		if e.Movie, err = db.GetMovie(id); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, auditRollback, auditEntityMovie, id, before, e.Movie); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("revision not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", movieETag(e.Movie))
+	if changed {
+		app.events.publish(e)
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
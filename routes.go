@@ -4,9 +4,20 @@ import (
 	"context"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"github.com/radish-miyazaki/manage-movies-api/models"
 	"net/http"
 )
 
+// route ルーティングテーブルの1エントリ
+// docはOpenAPIドキュメントの生成に利用する
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	secure  bool
+	doc     routeDoc
+}
+
 func (app *application) wrap(next http.Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, ps)
@@ -14,25 +25,441 @@ func (app *application) wrap(next http.Handler) httprouter.Handle {
 	}
 }
 
-func (app *application) routes() http.Handler {
-	router := httprouter.New()
-	secure := alice.New(app.checkToken)
+// routeTable 全てのルーティング定義
+func (app *application) routeTable() []route {
+	return []route{
+		{
+			method: http.MethodGet, path: "/status", handler: app.statusHandler,
+			doc: routeDoc{tag: "status", summary: "Application status", response: AppStatus{}},
+		},
+		{
+			method: http.MethodGet, path: "/v1/openapi.json", handler: app.openAPIHandler,
+			doc: routeDoc{tag: "status", summary: "This OpenAPI document", rawResponse: true},
+		},
+
+		{
+			method: http.MethodPost, path: "/v1/graphql", handler: app.moviesGraphQL,
+			doc: routeDoc{tag: "graphql", summary: "Execute a GraphQL query (persisted queries supported)", request: graphQLRequest{}, rawResponse: true},
+		},
+		{
+			method: http.MethodGet, path: "/v1/graphql", handler: app.graphQLWebSocket,
+			doc: routeDoc{tag: "graphql", summary: "GraphQL subscriptions over WebSocket (graphql-transport-ws)", rawResponse: true},
+		},
+
+		{
+			method: http.MethodGet, path: "/v1/images/*filepath", handler: app.serveStoredFile,
+			doc: routeDoc{tag: "movies", summary: "Uploaded images and thumbnails", rawResponse: true},
+		},
+
+		{
+			method: http.MethodPost, path: "/v1/login", handler: app.Login,
+			doc: routeDoc{tag: "auth", summary: "Issue a JWT for valid credentials", request: Credentials{}, response: "", wrap: "response"},
+		},
+
+		{
+			method: http.MethodGet, path: "/v1/movies", handler: app.getAllMovies,
+			doc: routeDoc{
+				tag: "movies", summary: "List all movies",
+				query: map[string]string{
+					"lang":     "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region":   "Country code (e.g. JP) whose release date and certification to show",
+					"tag":      "Only movies with this tag (repeat for movies with all of the tags)",
+					"provider": "Only movies currently available on this provider in region (repeat for any of the providers)",
+				},
+				response: []*models.Movie{}, wrap: "movies",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/movies/:id", handler: app.getMovie,
+			doc: routeDoc{
+				tag: "movies", summary: "Get a movie",
+				query: map[string]string{
+					"lang":   "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region": "Country code (e.g. JP) whose release date and certification to show",
+				},
+				response: models.Movie{}, wrap: "movie",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/movies/:id/similar", handler: app.getSimilarMovies,
+			doc: routeDoc{
+				tag: "movies", summary: "List similar movies by shared genres, release year, rating and shared reviewers",
+				query: map[string]string{
+					"limit":  "Maximum number of movies (default 10, max 50)",
+					"lang":   "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region": "Country code (e.g. JP) whose release date and certification to show",
+				},
+				response: []similarMovie{}, wrap: "similar",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/movies/:id/reviews", handler: app.getMovieReviews,
+			doc: routeDoc{
+				tag: "reviews", summary: "List reviews of a movie, newest first",
+				query:    map[string]string{"limit": "Page size (default 20, max 100)", "offset": "Number of reviews to skip"},
+				response: reviewList{},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/movies/:id/reviews", handler: app.createReview, secure: true,
+			doc: routeDoc{tag: "reviews", summary: "Review a movie as the signed-in user (one per movie)", request: ReviewPayload{}, response: models.Review{}, wrap: "review", status: http.StatusCreated},
+		},
+		{
+			method: http.MethodGet, path: "/v1/lookup/:source/:external_id", handler: app.lookupMovieByExternalID,
+			doc: routeDoc{
+				tag: "movies", summary: "Find a movie by its external id (source = imdb | tmdb)",
+				query: map[string]string{
+					"lang":   "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region": "Country code (e.g. JP) whose release date and certification to show",
+				},
+				response: models.Movie{}, wrap: "movie",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/tags", handler: app.searchTags,
+			doc: routeDoc{
+				tag: "tags", summary: "Search tags for autocomplete, with the number of movies per tag",
+				query:    map[string]string{"q": "Name contains (names starting with q come first)", "limit": "Maximum number of tags (default 10, max 100)"},
+				response: []*models.Tag{}, wrap: "tags",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/stats", handler: app.getStats,
+			doc: routeDoc{tag: "stats", summary: "Catalogue totals and breakdowns by genre, decade and MPAA rating", response: models.CatalogueStats{}, wrap: "stats"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/providers", handler: app.getProviders,
+			doc: routeDoc{tag: "providers", summary: "List streaming providers", response: []*models.Provider{}, wrap: "providers"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/collections", handler: app.getCollections,
+			doc: routeDoc{tag: "collections", summary: "List curated collections (without movies)", response: []*models.Collection{}, wrap: "collections"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/collections/:slug", handler: app.getCollection,
+			doc: routeDoc{
+				tag: "collections", summary: "Get a collection with its movies in order",
+				query: map[string]string{
+					"lang":   "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region": "Country code (e.g. JP) whose release date and certification to show",
+				},
+				response: models.Collection{}, wrap: "collection",
+			},
+		},
+		{
+			method: http.MethodPut, path: "/v1/reviews/:id", handler: app.updateReview, secure: true,
+			doc: routeDoc{tag: "reviews", summary: "Edit your own review", request: ReviewPayload{}, response: models.Review{}, wrap: "review"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/reviews/:id", handler: app.deleteReview, secure: true,
+			doc: routeDoc{tag: "reviews", summary: "Delete your own review", response: jsonRes{}, wrap: "response"},
+		},
+
+		// Create & Update HandleFunc
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/edit", handler: app.editMovie, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create (id = 0) or update a movie", request: MoviePayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/movie/delete/:id", handler: app.deleteMovie, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Move a movie to the trash", response: jsonRes{}, wrap: "response"},
+		},
+
+		{
+			method: http.MethodPost, path: "/v1/admin/movies/import", handler: app.importMoviesHandler, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Bulk import movies from CSV, a JSON array or NDJSON (upsert by title and year)",
+				query: map[string]string{
+					"format":  "csv, json or ndjson (default: from Content-Type)",
+					"dry_run": "Validate and report without writing",
+					"atomic":  "Write nothing if any row fails",
+				},
+				request: []ImportPayload{}, response: importSummary{}, wrap: "import",
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/movies/export", handler: app.exportMoviesHandler, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Stream the catalogue with genres as CSV, NDJSON or a JSON array",
+				query: map[string]string{
+					"format":      "csv (default), json or ndjson",
+					"title":       "Title contains",
+					"genre_id":    "Genre ID",
+					"year":        "Release year",
+					"min_rating":  "Minimum rating",
+					"mpaa_rating": "MPAA rating",
+					"tag":         "Tag (repeat for movies with all of the tags)",
+					"provider":    "Provider slug the movie is currently available on (repeat for any of the providers)",
+				},
+				rawResponse: true,
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/images/:id", handler: app.uploadMovieImage, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Upload a poster or backdrop (multipart/form-data: image, kind = poster | backdrop)",
+				response: models.MovieImage{}, wrap: "image", status: http.StatusCreated,
+			},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/movie/images/:id/:image_id", handler: app.deleteMovieImage, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Remove an image from a movie", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/credits/:id", handler: app.editMovieCredits, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace the cast and crew of a movie", request: CreditsPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/tags/:id", handler: app.editMovieTags, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace the tags of a movie (unknown tags are created)", request: MovieTagsPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/releases/:id", handler: app.editMovieReleases, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace the per-country release dates and certifications of a movie", request: ReleasesPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/movie/availability/:id", handler: app.getMovieAvailability, secure: true,
+			doc: routeDoc{tag: "admin", summary: "List where a movie can be watched, including expired and upcoming windows", response: []*models.Availability{}, wrap: "availability"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/availability/:id", handler: app.editMovieAvailability, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace where a movie can be watched (provider, region, offer type, price and window)", request: AvailabilityListPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/providers/edit", handler: app.editProvider, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create (id = 0) or update a streaming provider", request: ProviderPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/providers/delete/:id", handler: app.deleteProvider, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a streaming provider and its availability on all movies", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/genres/edit", handler: app.editGenre, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create (id = 0) or rename a genre", request: GenrePayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/genres/delete/:id", handler: app.deleteGenre, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a genre and remove it from all movies", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/webhooks", handler: app.getWebhooks, secure: true,
+			doc: routeDoc{tag: "webhooks", summary: "List webhook endpoints (secrets are not included)", response: []*models.Webhook{}, wrap: "webhooks"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/webhooks/edit", handler: app.editWebhook, secure: true,
+			doc: routeDoc{
+				tag: "webhooks", summary: "Create (id = 0) or update a webhook endpoint; the signing secret is returned only when it is set or rotated",
+				request: WebhookPayload{}, response: webhookRes{}, wrap: "webhook",
+			},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/webhooks/delete/:id", handler: app.deleteWebhook, secure: true,
+			doc: routeDoc{tag: "webhooks", summary: "Delete a webhook endpoint with its queued deliveries and delivery log", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/webhooks/deliveries/:id", handler: app.getWebhookDeliveries, secure: true,
+			doc: routeDoc{
+				tag: "webhooks", summary: "List deliveries of a webhook endpoint, newest first",
+				query:    map[string]string{"limit": "Page size (default 20, max 100)", "offset": "Number of deliveries to skip"},
+				response: deliveryList{},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/webhooks/delivery/:id", handler: app.getWebhookDelivery, secure: true,
+			doc: routeDoc{tag: "webhooks", summary: "Show a delivery with the log of every attempt", response: models.WebhookDelivery{}, wrap: "delivery"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/webhooks/redeliver/:id", handler: app.redeliverWebhook, secure: true,
+			doc: routeDoc{tag: "webhooks", summary: "Queue a delivery to be sent again with a fresh retry budget", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/external-ids/:id", handler: app.editMovieExternalIDs, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace the external ids (imdb, tmdb) of a movie", request: ExternalIDsPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/metadata/:id", handler: app.importMovieMetadata, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Fill a movie from the metadata provider by its external ids (manually edited fields are kept)",
+				query:    map[string]string{"dry_run": "Report what would change without writing"},
+				response: metadataReport{}, wrap: "metadata",
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/tags/rename/:id", handler: app.renameTag, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Rename a tag (409 if the name is taken: merge instead)", request: RenameTagPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/tags/merge", handler: app.mergeTags, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Merge duplicate tags into one", request: MergeTagsPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/tags/delete/:id", handler: app.deleteTag, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a tag and remove it from all movies", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/collections/edit", handler: app.editCollection, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create (id = 0) or update a collection", request: CollectionPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/collections/delete/:id", handler: app.deleteCollection, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a collection (its movies are kept)", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPut, path: "/v1/admin/collections/movies/:id", handler: app.editCollectionMovies, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Replace the movies of a collection in the given order", request: CollectionMoviesPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/movie/translations/:id", handler: app.getMovieTranslations, secure: true,
+			doc: routeDoc{tag: "admin", summary: "List translations of a movie", response: []*models.MovieTranslation{}, wrap: "translations"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/translations/:id", handler: app.editMovieTranslation, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create or update the title and description in a language", request: TranslationPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/movie/translations/:id/:locale", handler: app.deleteMovieTranslation, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a translation of a movie", response: jsonRes{}, wrap: "response"},
+		},
 
-	router.HandlerFunc(http.MethodGet, "/status", app.statusHandler)
+		{
+			method: http.MethodGet, path: "/v1/admin/movies/trash", handler: app.getTrash, secure: true,
+			doc: routeDoc{tag: "admin", summary: "List deleted movies", response: []*models.Movie{}, wrap: "movies"},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/restore/:id", handler: app.restoreMovie, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Restore a deleted movie", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/movie/purge/:id", handler: app.purgeMovie, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Permanently delete a movie in the trash", response: jsonRes{}, wrap: "response"},
+		},
 
-	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.moviesGraphQL)
+		{
+			method: http.MethodGet, path: "/v1/admin/movie/revisions/:id", handler: app.getMovieRevisions, secure: true,
+			doc: routeDoc{tag: "admin", summary: "List previous versions of a movie", response: []*models.MovieRevision{}, wrap: "revisions"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/admin/movie/revisions/:id/diff", handler: app.diffMovieRevisions, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Diff two versions of a movie",
+				query:    map[string]string{"from": "Version to compare from", "to": "Version to compare to (default: current)"},
+				response: revisionDiff{}, wrap: "diff",
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/movie/revisions/:id/rollback", handler: app.rollbackMovie, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Roll a movie back to a previous version", request: RollbackPayload{}, response: jsonRes{}, wrap: "response"},
+		},
 
-	router.HandlerFunc(http.MethodPost, "/v1/login", app.Login)
+		{
+			method: http.MethodGet, path: "/v1/admin/audit", handler: app.getAuditLog, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "Search the audit log of administrative changes",
+				query: map[string]string{
+					"actor":     "Actor user ID",
+					"action":    "create, update, delete, restore, purge",
+					"entity":    "Entity type (e.g. movie)",
+					"entity_id": "Entity ID",
+					"since":     "RFC 3339 lower bound (inclusive)",
+					"until":     "RFC 3339 upper bound (exclusive)",
+					"limit":     "Maximum number of entries (default 100, max 500)",
+				},
+				response: []*models.AuditEntry{}, wrap: "audit_log",
+			},
+		},
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.getAllMovies)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.getMovie)
+		{
+			method: http.MethodGet, path: "/v1/admin/people", handler: app.getPeople, secure: true,
+			doc: routeDoc{
+				tag: "admin", summary: "List people",
+				query:    map[string]string{"name": "Name contains"},
+				response: []*models.Person{}, wrap: "people",
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/admin/people/edit", handler: app.editPerson, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Create (id = 0) or update a person", request: PersonPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/admin/people/delete/:id", handler: app.deletePerson, secure: true,
+			doc: routeDoc{tag: "admin", summary: "Delete a person and their credits", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/people/:id", handler: app.getPerson,
+			doc: routeDoc{tag: "people", summary: "Get a person with their filmography", response: models.Person{}, wrap: "person"},
+		},
 
-	// Create & Update HandleFunc
-	router.POST("/v1/admin/movie/edit", app.wrap(secure.ThenFunc(app.editMovie)))
-	router.DELETE("/v1/admin/movie/delete/:id", app.wrap(secure.ThenFunc(app.deleteMovie)))
+		{
+			method: http.MethodGet, path: "/v1/me/watchlist", handler: app.getWatchlist, secure: true,
+			doc: routeDoc{
+				tag: "me", summary: "Your watchlist",
+				query:    map[string]string{"order": "position (default), added_at or title"},
+				response: []*models.WatchlistItem{}, wrap: "watchlist",
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/me/watchlist", handler: app.addToWatchlist, secure: true,
+			doc: routeDoc{tag: "me", summary: "Add a movie to your watchlist or update its note", request: WatchlistPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodPut, path: "/v1/me/watchlist/order", handler: app.reorderWatchlist, secure: true,
+			doc: routeDoc{tag: "me", summary: "Reorder your watchlist", request: WatchlistOrderPayload{}, response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/me/watchlist/:id", handler: app.removeFromWatchlist, secure: true,
+			doc: routeDoc{tag: "me", summary: "Remove a movie from your watchlist", response: jsonRes{}, wrap: "response"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/me/history", handler: app.getWatchHistory, secure: true,
+			doc: routeDoc{
+				tag: "me", summary: "Movies you have watched, newest first",
+				query:    map[string]string{"limit": "Page size (default 50, max 200)", "offset": "Number of entries to skip"},
+				response: watchHistory{},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/v1/me/history", handler: app.addWatchEvent, secure: true,
+			doc: routeDoc{tag: "me", summary: "Mark a movie as watched", request: WatchEventPayload{}, response: models.WatchEvent{}, wrap: "history", status: http.StatusCreated},
+		},
+		{
+			method: http.MethodDelete, path: "/v1/me/history/:id", handler: app.deleteWatchEvent, secure: true,
+			doc: routeDoc{tag: "me", summary: "Delete an entry from your history", response: jsonRes{}, wrap: "response"},
+		},
 
-	router.HandlerFunc(http.MethodGet, "/v1/genres", app.getAllGenres)
-	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.getAllMoviesByGenre)
+		{
+			method: http.MethodGet, path: "/v1/genres", handler: app.getAllGenres,
+			doc: routeDoc{tag: "genres", summary: "List all genres", response: []*models.Genre{}, wrap: "genres"},
+		},
+		{
+			method: http.MethodGet, path: "/v1/genres/:id", handler: app.getAllMoviesByGenre,
+			doc: routeDoc{
+				tag: "genres", summary: "List movies in a genre",
+				query: map[string]string{
+					"lang":   "Language tag to localize titles and descriptions (default: Accept-Language)",
+					"region": "Country code (e.g. JP) whose release date and certification to show",
+				},
+				response: []*models.Movie{}, wrap: "movies",
+			},
+		},
+	}
+}
+
+func (app *application) routes() http.Handler {
+	return app.enableCORS(app.assignRequestID(app.router()))
+}
+
+// router ルーティングテーブルの全てのルートを登録したルーター
+func (app *application) router() *httprouter.Router {
+	router := httprouter.New()
+	secure := alice.New(app.checkToken)
+
+	for _, rt := range app.routeTable() {
+		if rt.secure {
+			router.Handle(rt.method, rt.path, app.wrap(secure.ThenFunc(rt.handler)))
+		} else {
+			router.Handler(rt.method, rt.path, app.identifyUser(rt.handler))
+		}
+	}
 
-	return app.enableCORS(router)
+	return router
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// 類似度の各要素の重み
+// レビューしたユーザーの重なりは、どちらかの映画にレビューが無い場合は使わずに残りの重みで正規化する
+const (
+	similarGenreWeight    = 0.5
+	similarYearWeight     = 0.2
+	similarRatingWeight   = 0.1
+	similarReviewerWeight = 0.2
+)
+
+// similarYearRange 公開年がこの年数以上離れている場合は公開年の近さを0にする
+const similarYearRange = 20
+
+// 似ている映画の件数
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+// similarMovie 似ている映画とその類似度（0〜1）
+type similarMovie struct {
+	Movie *models.Movie `json:"movie"`
+	Score float64       `json:"score"`
+}
+
+// similarityScore movieに対するcandidateの類似度を0〜1で返す
+// ジャンルの重なり（Jaccard係数）、公開年の近さ、評価の近さ、両方をレビューしたユーザーの重なり（Jaccard係数）の加重平均で、
+// coReviewersは両方をレビューしたユーザー数。ジャンルもレビューしたユーザーも重ならない場合は0を返す
+func similarityScore(movie, candidate *models.Movie, coReviewers int) float64 {
+	shared := 0
+	for id := range candidate.MovieGenre {
+		if _, ok := movie.MovieGenre[id]; ok {
+			shared++
+		}
+	}
+	if shared == 0 && coReviewers == 0 {
+		return 0
+	}
+	var genres float64
+	if shared > 0 {
+		genres = float64(shared) / float64(len(movie.MovieGenre)+len(candidate.MovieGenre)-shared)
+	}
+
+	year := 1 - math.Abs(float64(movie.Year-candidate.Year))/similarYearRange
+	if year < 0 {
+		year = 0
+	}
+	rating := 1 - math.Abs(float64(movie.Rating-candidate.Rating))/5
+
+	score := similarGenreWeight*genres + similarYearWeight*year + similarRatingWeight*rating
+	total := similarGenreWeight + similarYearWeight + similarRatingWeight
+
+	a, b := reviewCount(movie), reviewCount(candidate)
+	if a > 0 && b > 0 {
+		score += similarReviewerWeight * float64(coReviewers) / float64(a+b-coReviewers)
+		total += similarReviewerWeight
+	}
+
+	// 比較・並び替えの結果が浮動小数点の誤差で変わらないよう小数第4位までにする
+	return math.Round(score/total*10000) / 10000
+}
+
+// reviewCount 映画のレビュー件数（レビューの集計が無い場合は0）
+func reviewCount(movie *models.Movie) int {
+	if movie.ReviewStats == nil {
+		return 0
+	}
+	return movie.ReviewStats.Count
+}
+
+// rankSimilarMovies candidatesをmovieとの類似度の高い順（同じ場合はIDの昇順）に最大limit件返す
+// movie自身と類似度が0のものは含めない。coReviewersは映画IDごとの両方をレビューしたユーザー数
+func rankSimilarMovies(movie *models.Movie, candidates []*models.Movie, coReviewers map[int]int, limit int) []similarMovie {
+	ranked := []similarMovie{}
+	for _, c := range candidates {
+		if c.ID == movie.ID {
+			continue
+		}
+		if score := similarityScore(movie, c, coReviewers[c.ID]); score > 0 {
+			ranked = append(ranked, similarMovie{Movie: c, Score: score})
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Movie.ID < ranked[j].Movie.ID
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// similarMovies 映画に似ている映画を類似度の高い順に最大limit件返す
+func (app *application) similarMovies(movie *models.Movie, limit int) ([]similarMovie, error) {
+	candidates, err := app.models.DB.GetAllMovies()
+	if err != nil {
+		return nil, err
+	}
+	coReviewers, err := app.models.DB.CoReviewerCounts(movie.ID)
+	if err != nil {
+		return nil, err
+	}
+	return rankSimilarMovies(movie, candidates, coReviewers, limit), nil
+}
+
+// getSimilarMovies 映画に似ている映画を類似度の高い順に返す
+func (app *application) getSimilarMovies(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+	q := r.URL.Query()
+	region, err := regionFromQuery(q)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	limit := defaultSimilarLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSimilarLimit {
+			app.errorJSON(w, fmt.Errorf("limit must be between 1 and %d", maxSimilarLimit))
+			return
+		}
+		limit = n
+	}
+
+	movie, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	// 類似度は全ての映画とレビューから計算するため、一覧と同じ条件で304を返す
+	v, err := app.models.DB.MoviesValidator()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	etag, lastModified, err := app.personalValidator(w, r, listETag("similar-"+strconv.Itoa(id), v), v.LastModified)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	locales := preferredLocales(r)
+	etag = localeETag(w, etag, locales)
+	if app.notModified(w, r, etag, lastModified) {
+		return
+	}
+
+	similar, err := app.similarMovies(movie, limit)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	movies := make([]*models.Movie, len(similar))
+	for i, s := range similar {
+		movies[i] = s.Movie
+	}
+	movies, err = app.withWatchlistFlags(r, localizeMovies(regionalizeMovies(movies, region), locales))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	for i := range similar {
+		similar[i].Movie = movies[i]
+	}
+
+	err = app.writeJSON(w, http.StatusOK, similar, "similar")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// similarField Movieのsimilarフィールド。似ている映画を類似度の高い順に返す
+func (app *application) similarField() *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.NewList(movieType),
+		Description: "Movies similar to this one by genres, release year, rating and shared reviewers, most similar first",
+		Args: graphql.FieldConfigArgument{
+			"limit": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				DefaultValue: defaultSimilarLimit,
+			},
+			"lang":   langArgument,
+			"region": regionArgument,
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			movie, ok := p.Source.(*models.Movie)
+			if !ok {
+				return nil, nil
+			}
+			limit, _ := p.Args["limit"].(int)
+			if limit < 1 || limit > maxSimilarLimit {
+				return nil, fmt.Errorf("limit must be between 1 and %d", maxSimilarLimit)
+			}
+
+			similar, err := app.similarMovies(movie, limit)
+			if err != nil {
+				return nil, err
+			}
+			movies := make([]*models.Movie, len(similar))
+			for i, s := range similar {
+				movies[i] = s.Movie
+			}
+			return localizeMovies(regionalizeMovies(movies, regionFromGraphQL(p.Args)), localesFromGraphQL(p.Context, p.Args)), nil
+		},
+	}
+}
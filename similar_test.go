@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"testing"
+)
+
+// testMovie テスト用の映画。reviewsが0の場合はレビューの集計を持たない
+func testMovie(id, year, rating, reviews int, genreIDs ...int) *models.Movie {
+	movie := &models.Movie{ID: id, Year: year, Rating: rating, MovieGenre: map[int]string{}}
+	for _, g := range genreIDs {
+		movie.MovieGenre[g] = "genre"
+	}
+	if reviews > 0 {
+		movie.ReviewStats = &models.ReviewStats{Count: reviews}
+	}
+	return movie
+}
+
+// TestSimilarityScore 各要素の重みと、レビューが無い場合に残りの重みで正規化すること
+func TestSimilarityScore(t *testing.T) {
+	tests := []struct {
+		name        string
+		movie       *models.Movie
+		candidate   *models.Movie
+		coReviewers int
+		want        float64
+	}{
+		{
+			// ジャンル 1/3*0.5 + 公開年 0.5*0.2 + 評価 0.8*0.1 + レビューしたユーザー 2/8*0.2
+			name:        "all factors",
+			movie:       testMovie(1, 2000, 4, 4, 1, 2),
+			candidate:   testMovie(2, 2010, 3, 6, 2, 3),
+			coReviewers: 2,
+			want:        0.3967,
+		},
+		{
+			// レビューしたユーザーの重みを除いた0.8で割る
+			name:      "no reviews",
+			movie:     testMovie(1, 2000, 4, 4, 1, 2),
+			candidate: testMovie(2, 2010, 3, 0, 2, 3),
+			want:      0.4333,
+		},
+		{
+			name:      "identical without reviews",
+			movie:     testMovie(1, 2000, 4, 0, 1, 2),
+			candidate: testMovie(2, 2000, 4, 0, 1, 2),
+			want:      1,
+		},
+		{
+			// 公開年はsimilarYearRange以上離れると0、評価は1/5ずつ下がる
+			name:      "distant year",
+			movie:     testMovie(1, 1950, 5, 0, 1),
+			candidate: testMovie(2, 2000, 0, 0, 1),
+			want:      0.625,
+		},
+		{
+			// ジャンルが重ならなくてもレビューしたユーザーが重なれば0にしない
+			name:        "co-reviewers only",
+			movie:       testMovie(1, 2000, 4, 2, 1),
+			candidate:   testMovie(2, 2000, 4, 2, 2),
+			coReviewers: 2,
+			want:        0.5,
+		},
+		{
+			name:      "nothing shared",
+			movie:     testMovie(1, 2000, 4, 2, 1),
+			candidate: testMovie(2, 2000, 4, 2, 2),
+			want:      0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarityScore(tt.movie, tt.candidate, tt.coReviewers); got != tt.want {
+				t.Errorf("similarityScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRankSimilarMovies 類似度の高い順に並べ、同じ類似度はIDの昇順にすること
+func TestRankSimilarMovies(t *testing.T) {
+	movie := testMovie(1, 2000, 4, 0, 1, 2)
+	candidates := []*models.Movie{
+		movie,
+		testMovie(7, 2000, 4, 0, 1),
+		testMovie(5, 2000, 4, 0, 1, 2),
+		testMovie(3, 2000, 4, 0, 1),
+		testMovie(4, 2000, 4, 0, 1),
+		testMovie(2, 2000, 4, 0, 3),
+	}
+
+	ranked := rankSimilarMovies(movie, candidates, nil, 3)
+
+	want := []int{5, 3, 4}
+	if len(ranked) != len(want) {
+		t.Fatalf("got %d movies, want %d", len(ranked), len(want))
+	}
+	for i, id := range want {
+		if ranked[i].Movie.ID != id {
+			t.Errorf("ranked[%d] = movie %d, want %d", i, ranked[i].Movie.ID, id)
+		}
+	}
+	if ranked[1].Score != ranked[2].Score {
+		t.Errorf("movies 3 and 4 should tie, got %v and %v", ranked[1].Score, ranked[2].Score)
+	}
+}
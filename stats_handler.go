@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// getStats カタログ全体の集計を返す
+func (app *application) getStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.models.DB.GetStats()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// 集計はキャッシュされている間は変わらないため、集計した日時をETagにする
+	etag := fmt.Sprintf(`"stats-%d"`, stats.GeneratedAt.UnixNano())
+	if app.notModified(w, r, etag, stats.GeneratedAt) {
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, stats, "stats")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
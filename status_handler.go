@@ -10,6 +10,7 @@ func (app *application) statusHandler(w http.ResponseWriter, r *http.Request) {
 		Status:      "Available",
 		Environment: app.config.env,
 		Version:     version,
+		Cache:       app.models.DB.Cache.Stats(),
 	}
 
 	js, err := json.MarshalIndent(currentStatus, "", "\t")
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage アップロードされたファイルの保存先
+// keyは"/"区切りの相対パスで、保存先ごとの場所への変換はStorageの実装が行う
+type Storage interface {
+	// Put keyにrの内容を保存する。既にある場合は置き換える
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Delete keyのファイルを削除する。無い場合は何もしない
+	Delete(ctx context.Context, key string) error
+	// URL keyのファイルをクライアントが取得するためのURLを返す
+	URL(key string) string
+}
+
+var errInvalidStorageKey = errors.New("invalid storage key")
+
+// localStorage ローカルファイルシステムのディレクトリに保存するStorage
+// 保存したファイルはServeHTTPで配信する
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+// newLocalStorage dir以下に保存し、baseURL以下のURLで配信するStorageを返す
+func newLocalStorage(dir, baseURL string) (*localStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &localStorage{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// path keyをdir以下のファイルパスに変換する。dirの外を指すキーはエラーにする
+func (s *localStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", errInvalidStorageKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// 書き込み途中のファイルが配信されないよう、一時ファイルに書いてから置き換える
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *localStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// ServeHTTP パスパラメータfilepathのファイルを配信する
+func (s *localStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	// ディレクトリの一覧は返さない
+	p, err := s.path(strings.TrimPrefix(params.ByName("filepath"), "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if fi, err := os.Stat(p); err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// 保存したキーは内容ごとに異なるため、長期間キャッシュしてよい
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, p)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTagLength タグ名の最大文字数
+const maxTagLength = 50
+
+// タグ検索の件数
+const (
+	defaultTagLimit = 10
+	maxTagLimit     = 100
+)
+
+// MovieTagsPayload 映画のタグを置き換えるリクエストボディ
+type MovieTagsPayload struct {
+	Version int      `json:"version"`
+	Tags    []string `json:"tags"`
+}
+
+// RenameTagPayload タグの名前を変更するリクエストボディ
+type RenameTagPayload struct {
+	Name string `json:"name"`
+}
+
+// MergeTagsPayload タグを統合するリクエストボディ
+// source_idsのタグをtarget_idのタグにまとめ、source_idsのタグは削除する
+type MergeTagsPayload struct {
+	TargetID  int   `json:"target_id"`
+	SourceIDs []int `json:"source_ids"`
+}
+
+// normalizeTag タグ名の前後の空白を除き、連続する空白を1つにまとめて小文字にする
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// validateTag 正規化したタグ名を検証する
+func validateTag(name string) error {
+	if name == "" {
+		return errors.New("tag must not be empty")
+	}
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return fmt.Errorf("tag must not be longer than %d characters", maxTagLength)
+	}
+	return nil
+}
+
+// tagsFromQuery クエリパラメータtag（複数指定可）を正規化して返す
+func tagsFromQuery(q url.Values) []string {
+	var tags []string
+	for _, tag := range q["tag"] {
+		if tag = normalizeTag(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// filterMoviesByTags tagsの全てが付いた映画に絞り込む。tagsが空の場合はmoviesをそのまま返す
+func filterMoviesByTags(movies []*models.Movie, tags []string) []*models.Movie {
+	if len(tags) == 0 {
+		return movies
+	}
+
+	filtered := []*models.Movie{}
+	for _, movie := range movies {
+		has := make(map[string]bool, len(movie.Tags))
+		for _, tag := range movie.Tags {
+			has[tag] = true
+		}
+		matched := true
+		for _, tag := range tags {
+			if !has[tag] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, movie)
+		}
+	}
+	return filtered
+}
+
+// searchTags 入力補完用にタグを映画の件数と合わせて返す
+// クエリパラメータ: q (部分一致、前方一致を優先), limit (デフォルト10、最大100)
+func (app *application) searchTags(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultTagLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTagLimit {
+			app.errorJSON(w, fmt.Errorf("limit must be between 1 and %d", maxTagLimit))
+			return
+		}
+		limit = n
+	}
+
+	tags, err := app.models.DB.SearchTags(normalizeTag(q.Get("q")), limit)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, tags, "tags")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editMovieTags 映画のタグを置き換える。存在しないタグは作成する
+// If-Matchヘッダーのバージョンをペイロードのバージョンより優先する
+func (app *application) editMovieTags(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload MovieTagsPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r, id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	conflictStatus := http.StatusPreconditionFailed
+	if expectedVersion == 0 {
+		expectedVersion = payload.Version
+		conflictStatus = http.StatusConflict
+	}
+
+	tags := make([]string, 0, len(payload.Tags))
+	seen := make(map[string]bool)
+	for i, tag := range payload.Tags {
+		tag = normalizeTag(tag)
+		if err := validateTag(tag); err != nil {
+			app.errorJSON(w, fmt.Errorf("tags[%d]: %v", i, err))
+			return
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	before, err := app.models.DB.GetMovie(id)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	err = app.changeMovie(w, r, before, func(db *models.DBModel) error {
+		return db.SetMovieTags(id, expectedVersion, tags)
+	})
+	if err == models.ErrEditConflict {
+		app.errorJSON(w, err, conflictStatus)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// renameTag タグの名前を変更する。同じ名前のタグが既にある場合は409を返す（統合を使う）
+func (app *application) renameTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var payload RenameTagPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	name := normalizeTag(payload.Name)
+	if err := validateTag(name); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetTag(id)
+		if err != nil {
+			return err
+		}
+		if err := db.RenameTag(id, name); err != nil {
+			return err
+		}
+
+		after := *before
+		after.Name = name
+		return app.audit(r.Context(), db, auditUpdate, auditEntityTag, id, before, after)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+		return
+	}
+	if err == models.ErrDuplicateTag {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// mergeTags 重複したタグを1つにまとめる
+func (app *application) mergeTags(w http.ResponseWriter, r *http.Request) {
+	var payload MergeTagsPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	if len(payload.SourceIDs) == 0 {
+		app.errorJSON(w, errors.New("source_ids is required"))
+		return
+	}
+	for i, sourceID := range payload.SourceIDs {
+		if sourceID == payload.TargetID {
+			app.errorJSON(w, fmt.Errorf("source_ids[%d]: a tag cannot be merged into itself", i))
+			return
+		}
+	}
+
+	before, err := app.models.DB.GetTag(payload.TargetID)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, fmt.Errorf("tag %d not found", payload.TargetID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	var sources []*models.Tag
+	for _, sourceID := range payload.SourceIDs {
+		tag, err := app.models.DB.GetTag(sourceID)
+		if err == sql.ErrNoRows {
+			app.errorJSON(w, fmt.Errorf("tag %d not found", sourceID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		sources = append(sources, tag)
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		if err := db.MergeTags(payload.TargetID, payload.SourceIDs); err != nil {
+			return err
+		}
+
+		after, err := db.GetTag(payload.TargetID)
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			if err := app.audit(r.Context(), db, auditDelete, auditEntityTag, source.ID, source, nil); err != nil {
+				return err
+			}
+		}
+		return app.audit(r.Context(), db, auditUpdate, auditEntityTag, payload.TargetID, before, after)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteTag タグを削除し、全ての映画から外す
+func (app *application) deleteTag(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetTag(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteTag(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditDelete, auditEntityTag, id, before, nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("tag not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
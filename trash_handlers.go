@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// getTrash ゴミ箱にある映画の一覧を返す
+func (app *application) getTrash(w http.ResponseWriter, r *http.Request) {
+	movies, err := app.models.DB.GetDeletedMovies()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// restoreMovie ゴミ箱にある映画を元に戻す
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	// 購読者から見ると一覧に再び現れるため作成として通知する
+	e := event{Type: eventMovieCreated, OccurredAt: time.Now()}
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		if err := db.RestoreMovie(id); err != nil {
+			return err
+		}
+
+		var err error
+		if e.Movie, err = db.GetMovie(id); err != nil {
+			return err
+		}
+		if err := app.audit(r.Context(), db, auditRestore, auditEntityMovie, id, nil, e.Movie); err != nil {
+			return err
+		}
+		return app.queueEvent(db, e)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("movie is not in the trash"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	app.events.publish(e)
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// purgeMovie ゴミ箱にある映画を完全に削除する
+func (app *application) purgeMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var keys []string
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var err error
+		if keys, err = db.PurgeMovie(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditPurge, auditEntityMovie, id, nil, nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("movie is not in the trash"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+	app.deleteStoredFiles(keys...)
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// purgeTrashPeriodically 保持期間を過ぎたゴミ箱の映画を定期的に完全削除する
+func (app *application) purgeTrashPeriodically(retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, keys, err := app.models.DB.PurgeDeletedMovies(time.Now().Add(-retention))
+		if err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		app.deleteStoredFiles(keys...)
+		if n > 0 {
+			app.logger.Println("Purged", n, "movies from the trash")
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配信一覧の1ページの件数
+const (
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+// minWebhookSecret 指定できる署名の鍵の最小文字数
+const minWebhookSecret = 16
+
+// WebhookPayload Webhookの作成・更新のリクエストボディ
+// Secretが空の場合、作成時は鍵を生成し、更新時は今の鍵のままにする。RotateSecretがtrueの場合は鍵を生成し直す
+type WebhookPayload struct {
+	ID           int      `json:"id"`
+	URL          string   `json:"url"`
+	EventTypes   []string `json:"event_types"`
+	Active       *bool    `json:"active"`
+	Secret       string   `json:"secret"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// webhookRes Webhookの作成・更新のレスポンス。署名の鍵は作成時と変更時だけ返す
+type webhookRes struct {
+	ID     int    `json:"id"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// deliveryList 配信一覧のレスポンス
+type deliveryList struct {
+	Deliveries []*models.WebhookDelivery `json:"deliveries"`
+	Metadata   pageMetadata              `json:"metadata"`
+}
+
+// newWebhookSecret 署名の鍵を生成する
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// getWebhooks Webhookの一覧を返す（署名の鍵は含めない）
+func (app *application) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.models.DB.GetWebhooks()
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, webhooks, "webhooks")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// editWebhook IDが0の場合はWebhookを作成し、それ以外の場合は更新する
+func (app *application) editWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload WebhookPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	webhook := models.Webhook{
+		ID:         payload.ID,
+		URL:        strings.TrimSpace(payload.URL),
+		EventTypes: []string{},
+		Active:     payload.Active == nil || *payload.Active,
+		Secret:     payload.Secret,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if !validWebURL(webhook.URL) {
+		app.errorJSON(w, errors.New("url must be an http or https URL"))
+		return
+	}
+	seen := map[string]bool{}
+	for _, t := range payload.EventTypes {
+		t = strings.TrimSpace(t)
+		if !validEventType(t) {
+			app.errorJSON(w, errors.New("unknown event type: "+t))
+			return
+		}
+		if !seen[t] {
+			seen[t] = true
+			webhook.EventTypes = append(webhook.EventTypes, t)
+		}
+	}
+	if len(webhook.EventTypes) == 0 {
+		app.errorJSON(w, errors.New("at least one event type is required"))
+		return
+	}
+	if webhook.Secret != "" && len(webhook.Secret) < minWebhookSecret {
+		app.errorJSON(w, errors.New("secret must be at least "+strconv.Itoa(minWebhookSecret)+" characters"))
+		return
+	}
+	if webhook.Secret == "" && (webhook.ID == 0 || payload.RotateSecret) {
+		webhook.Secret, err = newWebhookSecret()
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		var before *models.Webhook
+		var err error
+		action := auditUpdate
+		if webhook.ID == 0 {
+			action = auditCreate
+			webhook.ID, err = db.InsertWebhook(webhook)
+		} else {
+			before, err = db.GetWebhook(webhook.ID)
+			if err == nil {
+				err = db.UpdateWebhook(webhook)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, action, auditEntityWebhook, webhook.ID, before, webhook)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("webhook not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, webhookRes{ID: webhook.ID, Secret: webhook.Secret}, "webhook")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// deleteWebhook Webhookとその配信キュー・配信ログを削除する
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.Tx(func(db *models.DBModel) error {
+		before, err := db.GetWebhook(id)
+		if err != nil {
+			return err
+		}
+		if err := db.DeleteWebhook(id); err != nil {
+			return err
+		}
+		return app.audit(r.Context(), db, auditDelete, auditEntityWebhook, id, before, nil)
+	})
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("webhook not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getWebhookDeliveries Webhookの配信を新しい順に返す
+func (app *application) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	var res deliveryList
+	res.Metadata, err = parsePage(r.URL.Query(), defaultDeliveryLimit, maxDeliveryLimit)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if _, err := app.models.DB.GetWebhook(id); err != nil {
+		app.errorJSON(w, errors.New("webhook not found"), http.StatusNotFound)
+		return
+	}
+
+	res.Deliveries, res.Metadata.Total, err = app.models.DB.GetWebhookDeliveries(id, res.Metadata.Limit, res.Metadata.Offset)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, res, "")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// getWebhookDelivery 配信を配信ログと合わせて返す
+func (app *application) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	delivery, err := app.models.DB.GetWebhookDelivery(id)
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("delivery not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, delivery, "delivery")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
+
+// redeliverWebhook 配信をキューに戻し、次の送信処理で送り直す
+func (app *application) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		app.logger.Println(errors.New("invalid id parameter"))
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.DB.RedeliverWebhookDelivery(id, time.Now())
+	if err == sql.ErrNoRows {
+		app.errorJSON(w, errors.New("delivery not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok := jsonRes{OK: true}
+
+	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/radish-miyazaki/manage-movies-api/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhookの配信の設定
+const (
+	// webhookBatchSize 1回に取り出して送信する配信の件数
+	webhookBatchSize = 10
+	// webhookTimeout 1回の送信の待ち時間
+	webhookTimeout = 10 * time.Second
+	// webhookLease 取り出した配信を他のプロセスが送らないようにしておく時間（1回分の送信がすべて終わる長さ）
+	webhookLease = webhookBatchSize*webhookTimeout + time.Minute
+	// webhookMaxAttempts この回数送信に失敗した配信はfailedにして再試行をやめる
+	webhookMaxAttempts = 8
+	// webhookRetryBase・webhookRetryMax 再試行の間隔は失敗するたびに倍にし、上限で止める
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = 6 * time.Hour
+)
+
+// Webhookのリクエストヘッダー
+const (
+	webhookHeaderEvent     = "X-Webhook-Event"
+	webhookHeaderDelivery  = "X-Webhook-Delivery"
+	webhookHeaderTimestamp = "X-Webhook-Timestamp"
+	webhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// webhookEventTypes Webhookで購読できるイベントの種類
+var webhookEventTypes = []string{
+	eventMovieCreated, eventMovieUpdated, eventMovieDeleted,
+	eventGenreCreated, eventGenreUpdated, eventGenreDeleted,
+}
+
+// webhookClient Webhookの送信に使うHTTPクライアント
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookPayload Webhookで送信するJSON
+// movie.*の場合はmovieを、genre.*の場合はgenreを含める
+type webhookPayload struct {
+	Type       string        `json:"type"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	Movie      *models.Movie `json:"movie,omitempty"`
+	Genre      *models.Genre `json:"genre,omitempty"`
+}
+
+// validEventType Webhookの購読に指定できるイベントの種類か
+// 種類そのもののほか、"movie.*"のような同じ接頭辞のワイルドカードと"*"を受け付ける
+func validEventType(t string) bool {
+	if t == "*" {
+		return true
+	}
+	for _, et := range webhookEventTypes {
+		if t == et || t == et[:strings.Index(et, ".")]+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhook 送信時刻とボディをsecretでHMAC-SHA256署名し、"sha256="に続く16進数で返す
+// 受信側は"{X-Webhook-Timestamp}.{ボディ}"の署名を計算して比較する
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff attempts回目の送信に失敗した後、次に送信するまでの間隔
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempts && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	if d > webhookRetryMax {
+		d = webhookRetryMax
+	}
+	return d
+}
+
+// queueEvent 変更と同じトランザクションのdbで、イベントを購読しているWebhookへの配信をキューに追加する
+// コミットしなかった変更は通知されず、コミットした変更の通知はプロセスが終了しても失われない
+// プロセス内の購読者にはコミットした後にpublishで通知する
+func (app *application) queueEvent(db *models.DBModel, e event) error {
+	body, err := json.Marshal(webhookPayload{Type: e.Type, OccurredAt: e.OccurredAt, Movie: e.Movie, Genre: e.Genre})
+	if err != nil {
+		return err
+	}
+	_, err = db.EnqueueWebhookDeliveries(e.Type, body, e.OccurredAt)
+	return err
+}
+
+// deliverWebhooksPeriodically intervalごとに送信時刻を過ぎた配信を送信する
+func (app *application) deliverWebhooksPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := app.deliverWebhooks(); err != nil {
+			app.logger.Println(err)
+		}
+	}
+}
+
+// deliverWebhooks 送信時刻を過ぎた配信が無くなるまで取り出して送信する
+func (app *application) deliverWebhooks() error {
+	for {
+		now := time.Now()
+		deliveries, err := app.models.DB.ClaimWebhookDeliveries(webhookBatchSize, now, now.Add(webhookLease))
+		if err != nil {
+			return err
+		}
+
+		for _, d := range deliveries {
+			attempt := sendWebhook(d)
+
+			status, next := models.DeliverySucceeded, attempt.AttemptedAt
+			if attempt.Error != "" {
+				status, next = models.DeliveryPending, attempt.AttemptedAt.Add(webhookBackoff(d.Attempts+1))
+				if d.Attempts+1 >= webhookMaxAttempts {
+					status = models.DeliveryFailed
+				}
+			}
+			if err := app.models.DB.RecordWebhookAttempt(d.ID, attempt, status, next); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+// sendWebhook 配信を1回送信し、その結果を返す。2xx以外の応答はErrorに記録する
+func sendWebhook(d *models.WebhookDelivery) models.WebhookDeliveryAttempt {
+	start := time.Now()
+	attempt := models.WebhookDeliveryAttempt{AttemptedAt: start}
+
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "manage-movies-api-webhooks/"+version)
+	req.Header.Set(webhookHeaderEvent, d.EventType)
+	req.Header.Set(webhookHeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(webhookHeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(webhookHeaderSignature, signWebhook(d.Secret, start.Unix(), d.Payload))
+
+	res, err := webhookClient.Do(req)
+	attempt.DurationMS = int(time.Since(start) / time.Millisecond)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	// 接続を再利用できるよう応答のボディを読み捨てる
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	attempt.ResponseStatus = &res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = "unexpected response status " + res.Status
+	}
+	return attempt
+}